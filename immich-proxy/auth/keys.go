@@ -0,0 +1,55 @@
+// Package auth validates proxy-facing API keys, enforces per-key upload and
+// rate-limit quotas, and resolves the upstream Immich API key a request
+// should be forwarded with, so exposing the proxy's URL doesn't let anyone
+// hammer the Immich backend with whatever x-api-key they feel like sending.
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v3"
+)
+
+// APIKey is one entry in API_KEYS_FILE: a proxy-facing credential mapped to
+// per-key quotas and, optionally, the upstream Immich API key to send instead
+// of whatever the client provided.
+type APIKey struct {
+	ID             string  `json:"id" yaml:"id"`
+	HashedSecret   string  `json:"hashedSecret" yaml:"hashedSecret"`
+	MaxUploadBytes int64   `json:"maxUploadBytes,omitempty" yaml:"maxUploadBytes,omitempty"`
+	RatePerMinute  float64 `json:"ratePerMinute,omitempty" yaml:"ratePerMinute,omitempty"`
+	Burst          int     `json:"burst,omitempty" yaml:"burst,omitempty"`
+	DeviceIDPrefix string  `json:"deviceIdPrefix,omitempty" yaml:"deviceIdPrefix,omitempty"`
+	UpstreamAPIKey string  `json:"upstreamApiKey,omitempty" yaml:"upstreamApiKey,omitempty"`
+}
+
+// Matches reports whether secret is the plaintext proxy key for k.
+func (k APIKey) Matches(secret string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(k.HashedSecret), []byte(secret)) == nil
+}
+
+// LoadAPIKeys reads API_KEYS_FILE, picking YAML or JSON based on its
+// extension (defaulting to YAML for anything else).
+func LoadAPIKeys(path string) ([]APIKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read API keys file: %w", err)
+	}
+
+	var keys []APIKey
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		if err := json.Unmarshal(data, &keys); err != nil {
+			return nil, fmt.Errorf("failed to parse API keys file as JSON: %w", err)
+		}
+	} else {
+		if err := yaml.Unmarshal(data, &keys); err != nil {
+			return nil, fmt.Errorf("failed to parse API keys file as YAML: %w", err)
+		}
+	}
+	return keys, nil
+}
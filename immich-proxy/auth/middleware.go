@@ -0,0 +1,172 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/time/rate"
+)
+
+type contextKey string
+
+const apiKeyContextKey contextKey = "auth.apiKey"
+
+// Authenticator validates proxy-facing API keys loaded from API_KEYS_FILE and
+// enforces each key's rate limit, upload size cap, and device ID allowlist.
+type Authenticator struct {
+	keys     []APIKey
+	limiters sync.Map // id -> *rate.Limiter
+}
+
+// NewAuthenticator builds an Authenticator from the keys loaded from path.
+func NewAuthenticator(path string) (*Authenticator, error) {
+	keys, err := LoadAPIKeys(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Authenticator{keys: keys}, nil
+}
+
+// Middleware validates the Authorization: Bearer <proxy-key> header (or the
+// legacy X-Proxy-Key), enforces the key's quotas, and replaces the request's
+// x-api-key with the key's mapped upstream Immich key before calling next.
+// /health is exempt.
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key, ok := a.authenticate(bearerToken(r))
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if key.MaxUploadBytes > 0 && declaredUploadSize(r) > key.MaxUploadBytes {
+			http.Error(w, "Payload too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		if key.DeviceIDPrefix != "" && !deviceIDAllowed(r, key.DeviceIDPrefix) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		if limiter := a.limiterFor(key); !limiter.Allow() {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		if key.UpstreamAPIKey != "" {
+			r.Header.Set("x-api-key", key.UpstreamAPIKey)
+		}
+
+		ctx := context.WithValue(r.Context(), apiKeyContextKey, key)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func deviceIDAllowed(r *http.Request, prefix string) bool {
+	deviceID := r.Header.Get("X-Device-Id")
+	if deviceID == "" {
+		deviceID = r.URL.Query().Get("deviceId")
+	}
+	if deviceID == "" {
+		deviceID = tusMetadataDeviceID(r.Header.Get("Upload-Metadata"))
+	}
+	return deviceID == "" || strings.HasPrefix(deviceID, prefix)
+}
+
+// tusMetadataDeviceID extracts the deviceId value from a TUS Upload-Metadata
+// header ("key1 base64val1,key2 base64val2,..."), the only place a TUS
+// background upload (see handlers.TusUploadHandler) carries it: unlike
+// /api/assets/background, it never appears as X-Device-Id or a query param.
+func tusMetadataDeviceID(header string) string {
+	for _, pair := range strings.Split(header, ",") {
+		key, b64, ok := strings.Cut(strings.TrimSpace(pair), " ")
+		if !ok || key != "deviceId" {
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(b64)
+		if err != nil {
+			return ""
+		}
+		return string(decoded)
+	}
+	return ""
+}
+
+// declaredUploadSize returns the request's declared upload size: the TUS
+// Upload-Length header if present (the total size of a background upload
+// declared at creation, since PATCH chunks only ever carry a small fraction
+// of it per request), otherwise r.ContentLength.
+func declaredUploadSize(r *http.Request) int64 {
+	if v := r.Header.Get("Upload-Length"); v != "" {
+		if length, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return length
+		}
+	}
+	return r.ContentLength
+}
+
+func (a *Authenticator) authenticate(token string) (*APIKey, bool) {
+	if token == "" {
+		return nil, false
+	}
+	id, secret, ok := strings.Cut(token, ":")
+	if !ok {
+		return nil, false
+	}
+	for i := range a.keys {
+		if a.keys[i].ID == id && a.keys[i].Matches(secret) {
+			return &a.keys[i], true
+		}
+	}
+	return nil, false
+}
+
+// limiterFor returns the token-bucket limiter for key, creating it on first
+// use. ratePerMinute defaults to a conservative 60 req/min, and burst
+// defaults to the per-minute rate.
+func (a *Authenticator) limiterFor(key *APIKey) *rate.Limiter {
+	if v, ok := a.limiters.Load(key.ID); ok {
+		return v.(*rate.Limiter)
+	}
+
+	ratePerMinute := key.RatePerMinute
+	if ratePerMinute <= 0 {
+		ratePerMinute = 60
+	}
+	burst := key.Burst
+	if burst <= 0 {
+		burst = int(ratePerMinute)
+	}
+
+	limiter := rate.NewLimiter(rate.Limit(ratePerMinute/60), burst)
+	actual, _ := a.limiters.LoadOrStore(key.ID, limiter)
+	return actual.(*rate.Limiter)
+}
+
+// bearerToken extracts the proxy key from "Authorization: Bearer <key>",
+// falling back to the legacy X-Proxy-Key header.
+func bearerToken(r *http.Request) string {
+	if authHeader := r.Header.Get("Authorization"); authHeader != "" {
+		if rest, ok := strings.CutPrefix(authHeader, "Bearer "); ok {
+			return rest
+		}
+	}
+	return r.Header.Get("X-Proxy-Key")
+}
+
+// FromContext returns the authenticated APIKey for r's context, if any.
+func FromContext(ctx context.Context) (*APIKey, bool) {
+	key, ok := ctx.Value(apiKeyContextKey).(*APIKey)
+	return key, ok
+}
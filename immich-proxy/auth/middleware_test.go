@@ -0,0 +1,194 @@
+package auth
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func newTestAuthenticator(t *testing.T, keys ...APIKey) *Authenticator {
+	t.Helper()
+	return &Authenticator{keys: keys}
+}
+
+func hashSecret(t *testing.T, secret string) string {
+	t.Helper()
+	hashed, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("failed to hash secret: %v", err)
+	}
+	return string(hashed)
+}
+
+func TestMiddlewareRejectsMissingToken(t *testing.T) {
+	a := newTestAuthenticator(t, APIKey{ID: "a", HashedSecret: hashSecret(t, "s3cret")})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/assets/background", nil)
+	rec := httptest.NewRecorder()
+
+	a.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("next should not be called without a valid token")
+	})).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestMiddlewareAcceptsBearerTokenAndMapsUpstreamKey(t *testing.T) {
+	a := newTestAuthenticator(t, APIKey{
+		ID:             "a",
+		HashedSecret:   hashSecret(t, "s3cret"),
+		UpstreamAPIKey: "upstream-key",
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/assets/background", nil)
+	req.Header.Set("Authorization", "Bearer a:s3cret")
+	rec := httptest.NewRecorder()
+
+	var gotUpstreamKey string
+	a.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotUpstreamKey = r.Header.Get("x-api-key")
+		w.WriteHeader(http.StatusOK)
+	})).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if gotUpstreamKey != "upstream-key" {
+		t.Errorf("x-api-key = %q, want %q", gotUpstreamKey, "upstream-key")
+	}
+}
+
+func TestMiddlewareExemptsHealthEndpoint(t *testing.T) {
+	a := newTestAuthenticator(t, APIKey{ID: "a", HashedSecret: hashSecret(t, "s3cret")})
+
+	req := httptest.NewRequest(http.MethodGet, "/health", nil)
+	rec := httptest.NewRecorder()
+
+	called := false
+	a.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	})).ServeHTTP(rec, req)
+
+	if !called {
+		t.Error("/health should bypass authentication")
+	}
+}
+
+func TestMiddlewareEnforcesMaxUploadBytes(t *testing.T) {
+	a := newTestAuthenticator(t, APIKey{
+		ID:             "a",
+		HashedSecret:   hashSecret(t, "s3cret"),
+		MaxUploadBytes: 10,
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/assets/background", nil)
+	req.Header.Set("Authorization", "Bearer a:s3cret")
+	req.ContentLength = 100
+	rec := httptest.NewRecorder()
+
+	a.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("next should not be called when Content-Length exceeds MaxUploadBytes")
+	})).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusRequestEntityTooLarge)
+	}
+}
+
+func TestMiddlewareEnforcesMaxUploadBytesAgainstTusUploadLength(t *testing.T) {
+	a := newTestAuthenticator(t, APIKey{
+		ID:             "a",
+		HashedSecret:   hashSecret(t, "s3cret"),
+		MaxUploadBytes: 10,
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/assets/background/tus", nil)
+	req.Header.Set("Authorization", "Bearer a:s3cret")
+	req.Header.Set("Upload-Length", "100")
+	req.ContentLength = 0 // TUS creation without creation-with-upload has no body
+	rec := httptest.NewRecorder()
+
+	a.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("next should not be called when Upload-Length exceeds MaxUploadBytes")
+	})).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusRequestEntityTooLarge)
+	}
+}
+
+func TestMiddlewareEnforcesDeviceIDPrefixFromTusMetadata(t *testing.T) {
+	a := newTestAuthenticator(t, APIKey{
+		ID:             "a",
+		HashedSecret:   hashSecret(t, "s3cret"),
+		DeviceIDPrefix: "allowed-",
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/assets/background/tus", nil)
+	req.Header.Set("Authorization", "Bearer a:s3cret")
+	req.Header.Set("Upload-Metadata", "deviceId "+base64.StdEncoding.EncodeToString([]byte("other-device")))
+	rec := httptest.NewRecorder()
+
+	a.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("next should not be called when the TUS metadata deviceId doesn't match the allowed prefix")
+	})).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+}
+
+func TestMiddlewareAllowsMatchingDeviceIDFromTusMetadata(t *testing.T) {
+	a := newTestAuthenticator(t, APIKey{
+		ID:             "a",
+		HashedSecret:   hashSecret(t, "s3cret"),
+		DeviceIDPrefix: "allowed-",
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/assets/background/tus", nil)
+	req.Header.Set("Authorization", "Bearer a:s3cret")
+	req.Header.Set("Upload-Metadata", "deviceId "+base64.StdEncoding.EncodeToString([]byte("allowed-device")))
+	rec := httptest.NewRecorder()
+
+	called := false
+	a.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	})).ServeHTTP(rec, req)
+
+	if !called {
+		t.Error("expected next to be called when the TUS metadata deviceId matches the allowed prefix")
+	}
+}
+
+func TestMiddlewareEnforcesRateLimit(t *testing.T) {
+	a := newTestAuthenticator(t, APIKey{
+		ID:            "a",
+		HashedSecret:  hashSecret(t, "s3cret"),
+		RatePerMinute: 60,
+		Burst:         1,
+	})
+
+	handler := a.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	makeRequest := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/assets/background", nil)
+		req.Header.Set("Authorization", "Bearer a:s3cret")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := makeRequest(); rec.Code != http.StatusOK {
+		t.Fatalf("first request status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if rec := makeRequest(); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("second request status = %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+}
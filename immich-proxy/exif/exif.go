@@ -0,0 +1,99 @@
+// Package exif does minimal, streaming-friendly inspection and sanitization
+// of EXIF metadata embedded in uploaded assets, so the proxy can fill in GPS
+// and capture-time fields the iOS extension left blank and, if configured,
+// strip tags (GPS, or everything) before the bytes ever reach Immich.
+package exif
+
+import (
+	"bytes"
+	"io"
+	"log"
+)
+
+// StripMode controls which EXIF tags are removed before forwarding an asset.
+type StripMode string
+
+const (
+	StripNone StripMode = "none"
+	StripGPS  StripMode = "gps"
+	StripAll  StripMode = "all"
+)
+
+// ParseStripMode parses the EXIF_STRIP_MODE env var, defaulting to StripNone
+// for empty or unrecognized values.
+func ParseStripMode(s string) StripMode {
+	switch StripMode(s) {
+	case StripGPS, StripAll:
+		return StripMode(s)
+	default:
+		return StripNone
+	}
+}
+
+// Info holds the EXIF fields a caller can use to fill in metadata that the
+// iOS extension did not provide.
+type Info struct {
+	Latitude         float64
+	Longitude        float64
+	HasGPS           bool
+	DateTimeOriginal string // raw EXIF format, e.g. "2026:07:30 12:00:00"
+}
+
+// Process inspects the image at the front of r and returns a reader that
+// reproduces the asset, sanitized per mode for formats it understands
+// (JPEG, HEIC/HEIF, and raw TIFF/DNG). It never fails the caller's upload:
+// on a parse error it logs a warning and passes r through untouched,
+// alongside a zero-value Info. Formats outside that set (video, PNG, ...)
+// are passed through untouched without a warning, since they were never in
+// scope for EXIF handling.
+func Process(r io.Reader, mode StripMode) (io.Reader, *Info) {
+	sigBuf := make([]byte, 12)
+	n, _ := io.ReadFull(r, sigBuf)
+	sig := sigBuf[:n]
+	rest := io.MultiReader(bytes.NewReader(sig), r)
+
+	switch {
+	case len(sig) >= 2 && sig[0] == 0xFF && sig[1] == 0xD8:
+		out, info, err := FilterJPEG(rest, mode)
+		if err != nil {
+			log.Printf("exif: failed to parse JPEG, passing upload through untouched: %v", err)
+			return out, &Info{}
+		}
+		return out, info
+	case len(sig) >= 12 && bytes.Equal(sig[4:8], []byte("ftyp")) && isHEIFBrand(sig[8:12]):
+		out, info, err := FilterHEIC(rest, mode)
+		if err != nil {
+			log.Printf("exif: failed to parse HEIC, passing upload through untouched: %v", err)
+			return out, &Info{}
+		}
+		return out, info
+	case len(sig) >= 4 && isTIFFMagic(sig):
+		out, info, err := FilterTIFF(rest, mode)
+		if err != nil {
+			log.Printf("exif: failed to parse raw TIFF/DNG, passing upload through untouched: %v", err)
+			return out, &Info{}
+		}
+		return out, info
+	default:
+		return rest, &Info{}
+	}
+}
+
+// isTIFFMagic reports whether sig starts with a TIFF byte-order marker
+// ("II*\x00" little-endian or "MM\x00*" big-endian), i.e. the file is a raw
+// TIFF-based format such as DNG rather than a TIFF payload wrapped in a
+// JPEG APP1 segment or a HEIC item.
+func isTIFFMagic(sig []byte) bool {
+	return bytes.Equal(sig[0:4], []byte{0x49, 0x49, 0x2A, 0x00}) ||
+		bytes.Equal(sig[0:4], []byte{0x4D, 0x4D, 0x00, 0x2A})
+}
+
+// isHEIFBrand reports whether brand, the major brand of an ftyp box, marks a
+// HEIC/HEIF image rather than MP4/MOV video, which also begins with ftyp.
+func isHEIFBrand(brand []byte) bool {
+	switch string(brand) {
+	case "heic", "heix", "heim", "heis", "hevc", "hevx", "mif1", "msf1":
+		return true
+	}
+	return false
+}
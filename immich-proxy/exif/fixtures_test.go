@@ -0,0 +1,76 @@
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// buildTIFFWithGPS assembles a minimal big-endian TIFF byte stream (IFD0 ->
+// GPS IFD, no Exif IFD) encoding 37.7749 N, 122.4194 W, shared by the JPEG,
+// raw TIFF, and HEIC tests since all three end up walking the same IFD
+// structure once their format-specific wrapper is stripped away.
+func buildTIFFWithGPS(t *testing.T) []byte {
+	t.Helper()
+
+	order := binary.BigEndian // "MM"
+	var tiff bytes.Buffer
+	tiff.WriteString("MM")
+	writeU16 := func(v uint16) { _ = binary.Write(&tiff, order, v) }
+	writeU32 := func(v uint32) { _ = binary.Write(&tiff, order, v) }
+
+	writeU16(0x002A)
+	writeU32(8) // IFD0 offset
+
+	// IFD0: one entry (GPSInfoIFDPointer), pointing right after this IFD.
+	const ifd0EntryCount = 1
+	ifd0Offset := 8
+	gpsIFDOffset := uint32(ifd0Offset + 2 + ifd0EntryCount*12 + 4)
+
+	writeU16(ifd0EntryCount)
+	writeU16(tagGPSIFDPointer)
+	writeU16(typeLong)
+	writeU32(1)
+	writeU32(gpsIFDOffset)
+	writeU32(0) // no next IFD
+
+	// GPS IFD: LatRef, Lat, LonRef, Lon -- rationals stored right after the IFD.
+	const gpsEntryCount = 4
+	ratBase := gpsIFDOffset + 2 + gpsEntryCount*12 + 4
+
+	writeU16(gpsEntryCount)
+
+	writeU16(tagGPSLatitudeRef)
+	writeU16(typeASCII)
+	writeU32(2)
+	tiff.WriteString("N\x00\x00\x00")
+
+	writeU16(tagGPSLatitude)
+	writeU16(typeRational)
+	writeU32(3)
+	writeU32(ratBase)
+
+	writeU16(tagGPSLongitudeRef)
+	writeU16(typeASCII)
+	writeU32(2)
+	tiff.WriteString("W\x00\x00\x00")
+
+	writeU16(tagGPSLongitude)
+	writeU16(typeRational)
+	writeU32(3)
+	writeU32(ratBase + 24)
+
+	writeU32(0) // no next IFD
+
+	// Latitude 37 deg 46 min 29.64 sec; Longitude 122 deg 25 min 9.84 sec.
+	for _, pair := range [][2]uint32{{37, 1}, {46, 1}, {2964, 100}} {
+		writeU32(pair[0])
+		writeU32(pair[1])
+	}
+	for _, pair := range [][2]uint32{{122, 1}, {25, 1}, {984, 100}} {
+		writeU32(pair[0])
+		writeU32(pair[1])
+	}
+
+	return tiff.Bytes()
+}
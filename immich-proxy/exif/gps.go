@@ -0,0 +1,118 @@
+package exif
+
+import "encoding/binary"
+
+// extractGPSAndTime walks IFD0, the Exif IFD, and the GPS IFD of a parsed
+// TIFF payload, populating info with whatever DateTimeOriginal and GPS
+// coordinates it finds. Malformed or missing IFDs are ignored rather than
+// treated as fatal, since EXIF extraction is best-effort.
+func extractGPSAndTime(tiff []byte, info *Info) {
+	order, ifd0Offset, err := parseTIFFHeader(tiff)
+	if err != nil {
+		return
+	}
+	ifd0, _, err := readIFD(tiff, order, ifd0Offset)
+	if err != nil {
+		return
+	}
+
+	for _, e := range ifd0 {
+		switch e.tag {
+		case tagExifIFDPointer:
+			extractDateTimeOriginal(tiff, order, e.asUint32(order), info)
+		case tagGPSIFDPointer:
+			extractGPSCoordinates(tiff, order, e.asUint32(order), info)
+		}
+	}
+}
+
+func extractDateTimeOriginal(tiff []byte, order binary.ByteOrder, exifIFDOffset uint32, info *Info) {
+	exifIFD, _, err := readIFD(tiff, order, exifIFDOffset)
+	if err != nil {
+		return
+	}
+	for _, e := range exifIFD {
+		if e.tag == tagDateTimeOriginal {
+			info.DateTimeOriginal = e.asASCII(tiff, order)
+		}
+	}
+}
+
+func extractGPSCoordinates(tiff []byte, order binary.ByteOrder, gpsIFDOffset uint32, info *Info) {
+	gpsIFD, _, err := readIFD(tiff, order, gpsIFDOffset)
+	if err != nil {
+		return
+	}
+
+	latRef, lonRef := byte('N'), byte('E')
+	var lat, lon []rational
+
+	for _, e := range gpsIFD {
+		switch e.tag {
+		case tagGPSLatitudeRef:
+			if b := e.valueBytes(tiff, order); len(b) > 0 {
+				latRef = b[0]
+			}
+		case tagGPSLongitudeRef:
+			if b := e.valueBytes(tiff, order); len(b) > 0 {
+				lonRef = b[0]
+			}
+		case tagGPSLatitude:
+			lat = readRationals(e.valueBytes(tiff, order), order, 3)
+		case tagGPSLongitude:
+			lon = readRationals(e.valueBytes(tiff, order), order, 3)
+		}
+	}
+
+	if len(lat) == 3 && len(lon) == 3 {
+		info.Latitude = dmsToDecimal(lat, latRef)
+		info.Longitude = dmsToDecimal(lon, lonRef)
+		info.HasGPS = true
+	}
+}
+
+// stripGPS mutates tiff in place so the GPS IFD becomes unreachable: the
+// IFD0 entry pointing at it is zeroed out and the GPS IFD's own entry count
+// is zeroed too, so a conforming reader sees no GPS tags. This avoids having
+// to relocate or resize anything else in the file.
+func stripGPS(tiff []byte) {
+	order, ifd0Offset, err := parseTIFFHeader(tiff)
+	if err != nil {
+		return
+	}
+	ifd0, _, err := readIFD(tiff, order, ifd0Offset)
+	if err != nil {
+		return
+	}
+
+	for _, e := range ifd0 {
+		if e.tag != tagGPSIFDPointer {
+			continue
+		}
+
+		gpsOffset := e.asUint32(order)
+		if int(gpsOffset)+2 <= len(tiff) {
+			order.PutUint16(tiff[gpsOffset:gpsOffset+2], 0)
+		}
+
+		// Zero the tag field and the pointer value so IFD0's own entry no
+		// longer identifies or references the (now-empty) GPS IFD.
+		order.PutUint16(tiff[e.offset-8:e.offset-6], 0)
+		order.PutUint32(tiff[e.offset:e.offset+4], 0)
+	}
+}
+
+// stripAllTags mutates tiff in place so IFD0 becomes unreachable: its entry
+// count is zeroed, so a conforming reader sees a directory with no tags at
+// all (which also hides the Exif/GPS sub-IFDs IFD0 would otherwise point to).
+// Like stripGPS, this avoids relocating or resizing anything in the file.
+func stripAllTags(tiff []byte) {
+	order, ifd0Offset, err := parseTIFFHeader(tiff)
+	if err != nil {
+		return
+	}
+	if int(ifd0Offset)+2 > len(tiff) {
+		return
+	}
+	order.PutUint16(tiff[ifd0Offset:ifd0Offset+2], 0)
+}
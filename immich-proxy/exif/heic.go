@@ -0,0 +1,377 @@
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// maxHEICMetaBoxSize bounds how large a 'meta' box FilterHEIC will buffer to
+// walk its iinf/iloc tables. The meta box holds only item directories and
+// small metadata items, never the image/video codestreams (those live in
+// mdat), so real-world HEIC files keep it well under this cap.
+const maxHEICMetaBoxSize = 4 << 20 // 4MiB
+
+// maxHEICSkipBoxSize bounds the top-level boxes (e.g. ftyp) FilterHEIC copies
+// through verbatim while searching for 'meta', as a sanity limit against a
+// malformed file claiming an enormous box size.
+const maxHEICSkipBoxSize = 16 << 20 // 16MiB
+
+// FilterHEIC locates the Exif item in an HEIC/HEIF file's meta box (via its
+// iinf item-info and iloc item-location tables) and extracts or strips it in
+// place, without buffering the mdat box's image data: everything up to and
+// including the Exif item is buffered, and the remainder of the file streams
+// through the original reader untouched, mirroring FilterJPEG's approach to
+// the compressed scan data that follows its header.
+//
+// Only the common case camera-written HEIC files use is supported: a single
+// Exif item located by a file-offset (construction_method 0) extent in a
+// 'meta' box that appears before the Exif item's bytes in the file. Anything
+// else (a differently-constructed item, a missing meta/iinf/iloc box, or a
+// box structure this function can't walk) returns an error so the caller
+// logs a warning and passes the asset through untouched.
+func FilterHEIC(r io.Reader, mode StripMode) (io.Reader, *Info, error) {
+	var raw, out bytes.Buffer
+	info := &Info{}
+
+	read := func(n int64) ([]byte, error) {
+		buf := make([]byte, n)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		raw.Write(buf)
+		return buf, nil
+	}
+	onError := func(err error) (io.Reader, *Info, error) {
+		return io.MultiReader(&raw, r), info, err
+	}
+	passThrough := func(n int64) error {
+		buf, err := read(n)
+		if err != nil {
+			return err
+		}
+		out.Write(buf)
+		return nil
+	}
+
+	var metaBox []byte
+	for metaBox == nil {
+		header, err := read(8)
+		if err != nil {
+			return onError(fmt.Errorf("failed to read box header: %w", err))
+		}
+		size := int64(binary.BigEndian.Uint32(header[0:4]))
+		boxType := string(header[4:8])
+
+		if size == 1 {
+			ext, err := read(8)
+			if err != nil {
+				return onError(fmt.Errorf("failed to read box largesize: %w", err))
+			}
+			size = int64(binary.BigEndian.Uint64(ext))
+			header = append(header, ext...)
+		}
+		if size < int64(len(header)) {
+			return onError(errors.New("invalid HEIC box size"))
+		}
+		contentLen := size - int64(len(header))
+
+		if boxType == "meta" {
+			if contentLen > maxHEICMetaBoxSize {
+				return onError(fmt.Errorf("meta box too large to buffer (%d bytes)", contentLen))
+			}
+			out.Write(header)
+			content, err := read(contentLen)
+			if err != nil {
+				return onError(fmt.Errorf("failed to read meta box: %w", err))
+			}
+			out.Write(content)
+			metaBox = content
+			break
+		}
+
+		if boxType == "mdat" {
+			return onError(errors.New("HEIC mdat box encountered before meta box"))
+		}
+		if contentLen > maxHEICSkipBoxSize {
+			return onError(fmt.Errorf("%s box too large to buffer (%d bytes)", boxType, contentLen))
+		}
+		out.Write(header)
+		if err := passThrough(contentLen); err != nil {
+			return onError(fmt.Errorf("failed to copy %s box: %w", boxType, err))
+		}
+	}
+
+	exifOffset, exifLength, err := locateHEICExifItem(metaBox)
+	if err != nil {
+		return onError(fmt.Errorf("failed to locate Exif item: %w", err))
+	}
+	if exifOffset < int64(raw.Len()) {
+		return onError(errors.New("Exif item lies before the current read position"))
+	}
+
+	if err := passThrough(exifOffset - int64(raw.Len())); err != nil {
+		return onError(fmt.Errorf("failed to seek to Exif item: %w", err))
+	}
+
+	exifItemData, err := read(exifLength)
+	if err != nil {
+		return onError(fmt.Errorf("failed to read Exif item: %w", err))
+	}
+
+	// Per the HEIF Exif item format, the item's data begins with a
+	// big-endian uint32 giving the byte offset (from right after that
+	// field) to the start of the TIFF header; camera-written files
+	// universally place "Exif\0\0" there, immediately before the TIFF data.
+	if len(exifItemData) < 4 {
+		return onError(errors.New("Exif item too short"))
+	}
+	tiffStart := 4 + int(binary.BigEndian.Uint32(exifItemData[0:4]))
+	if tiffStart > len(exifItemData) {
+		return onError(errors.New("Exif item TIFF header offset out of range"))
+	}
+	tiff := exifItemData[tiffStart:]
+
+	extractGPSAndTime(tiff, info)
+	switch mode {
+	case StripAll:
+		stripAllTags(tiff)
+	case StripGPS:
+		stripGPS(tiff)
+	}
+
+	out.Write(exifItemData)
+
+	return io.MultiReader(&out, r), info, nil
+}
+
+// locateHEICExifItem parses a meta box's iinf and iloc child boxes to find
+// the Exif item's absolute file offset and length.
+func locateHEICExifItem(meta []byte) (int64, int64, error) {
+	if len(meta) < 4 {
+		return 0, 0, errors.New("meta box too short")
+	}
+	body := meta[4:] // skip meta's own FullBox version/flags
+
+	var iinf, iloc []byte
+	pos := 0
+	for pos+8 <= len(body) {
+		size := int(binary.BigEndian.Uint32(body[pos : pos+4]))
+		boxType := string(body[pos+4 : pos+8])
+		if size < 8 || pos+size > len(body) {
+			break
+		}
+		switch boxType {
+		case "iinf":
+			iinf = body[pos+8 : pos+size]
+		case "iloc":
+			iloc = body[pos+8 : pos+size]
+		}
+		pos += size
+	}
+	if iinf == nil {
+		return 0, 0, errors.New("meta box has no iinf box")
+	}
+	if iloc == nil {
+		return 0, 0, errors.New("meta box has no iloc box")
+	}
+
+	itemID, err := findExifItemID(iinf)
+	if err != nil {
+		return 0, 0, err
+	}
+	return findItemLocation(iloc, itemID)
+}
+
+// findExifItemID walks an iinf (ItemInfoBox)'s infe (ItemInfoEntry) children
+// looking for the one whose item_type is "Exif", returning its item_ID.
+func findExifItemID(iinf []byte) (uint32, error) {
+	if len(iinf) < 4 {
+		return 0, errors.New("iinf box too short")
+	}
+	version := iinf[0]
+
+	var entryCount, pos int
+	if version == 0 {
+		if len(iinf) < 6 {
+			return 0, errors.New("iinf box truncated")
+		}
+		entryCount = int(binary.BigEndian.Uint16(iinf[4:6]))
+		pos = 6
+	} else {
+		if len(iinf) < 8 {
+			return 0, errors.New("iinf box truncated")
+		}
+		entryCount = int(binary.BigEndian.Uint32(iinf[4:8]))
+		pos = 8
+	}
+
+	for i := 0; i < entryCount && pos+8 <= len(iinf); i++ {
+		size := int(binary.BigEndian.Uint32(iinf[pos : pos+4]))
+		boxType := string(iinf[pos+4 : pos+8])
+		if size < 8 || pos+size > len(iinf) {
+			break
+		}
+		if boxType == "infe" {
+			if id, ok := exifItemIDFromInfe(iinf[pos+8 : pos+size]); ok {
+				return id, nil
+			}
+		}
+		pos += size
+	}
+	return 0, errors.New("no Exif item found in iinf box")
+}
+
+// exifItemIDFromInfe reports the item_ID of an infe (ItemInfoEntry) box if
+// its item_type is "Exif". Only versions 2 and 3, the ones HEIF uses, are
+// understood.
+func exifItemIDFromInfe(infe []byte) (uint32, bool) {
+	if len(infe) < 4 {
+		return 0, false
+	}
+	version := infe[0]
+	pos := 4
+
+	var itemID uint32
+	switch version {
+	case 2:
+		if pos+2 > len(infe) {
+			return 0, false
+		}
+		itemID = uint32(binary.BigEndian.Uint16(infe[pos : pos+2]))
+		pos += 2 + 2 // item_ID, protection_index
+	case 3:
+		if pos+4 > len(infe) {
+			return 0, false
+		}
+		itemID = binary.BigEndian.Uint32(infe[pos : pos+4])
+		pos += 4 + 2 // item_ID, protection_index
+	default:
+		return 0, false
+	}
+
+	if pos+4 > len(infe) {
+		return 0, false
+	}
+	if string(infe[pos:pos+4]) != "Exif" {
+		return 0, false
+	}
+	return itemID, true
+}
+
+// findItemLocation walks an iloc (ItemLocationBox) for itemID's first extent
+// and returns its absolute file offset and length. Items located via
+// anything other than construction_method 0 (plain file offset) are
+// rejected, since that's the only method camera-written HEIC files use for
+// the Exif item.
+func findItemLocation(iloc []byte, itemID uint32) (int64, int64, error) {
+	if len(iloc) < 4 {
+		return 0, 0, errors.New("iloc box too short")
+	}
+	version := iloc[0]
+	pos := 4
+
+	if pos+2 > len(iloc) {
+		return 0, 0, errors.New("iloc box truncated")
+	}
+	offsetSize := int(iloc[pos] >> 4)
+	lengthSize := int(iloc[pos] & 0x0F)
+	baseOffsetSize := int(iloc[pos+1] >> 4)
+	indexSize := int(iloc[pos+1] & 0x0F)
+	pos += 2
+
+	var itemCount int
+	if version < 2 {
+		if pos+2 > len(iloc) {
+			return 0, 0, errors.New("iloc box truncated")
+		}
+		itemCount = int(binary.BigEndian.Uint16(iloc[pos : pos+2]))
+		pos += 2
+	} else {
+		if pos+4 > len(iloc) {
+			return 0, 0, errors.New("iloc box truncated")
+		}
+		itemCount = int(binary.BigEndian.Uint32(iloc[pos : pos+4]))
+		pos += 4
+	}
+
+	readField := func(n int) (uint64, error) {
+		if n == 0 {
+			return 0, nil
+		}
+		if pos+n > len(iloc) {
+			return 0, errors.New("iloc box truncated")
+		}
+		var v uint64
+		for _, b := range iloc[pos : pos+n] {
+			v = v<<8 | uint64(b)
+		}
+		pos += n
+		return v, nil
+	}
+
+	for i := 0; i < itemCount; i++ {
+		idSize := 2
+		if version >= 2 {
+			idSize = 4
+		}
+		id, err := readField(idSize)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		var constructionMethod uint64
+		if version == 1 || version == 2 {
+			constructionMethod, err = readField(2)
+			if err != nil {
+				return 0, 0, err
+			}
+		}
+
+		if _, err := readField(2); err != nil { // data_reference_index
+			return 0, 0, err
+		}
+
+		baseOffset, err := readField(baseOffsetSize)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		extentCount, err := readField(2)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		var firstExtentOffset, firstExtentLength uint64
+		for e := 0; e < int(extentCount); e++ {
+			if (version == 1 || version == 2) && indexSize > 0 {
+				if _, err := readField(indexSize); err != nil {
+					return 0, 0, err
+				}
+			}
+			extOffset, err := readField(offsetSize)
+			if err != nil {
+				return 0, 0, err
+			}
+			extLength, err := readField(lengthSize)
+			if err != nil {
+				return 0, 0, err
+			}
+			if e == 0 {
+				firstExtentOffset = extOffset
+				firstExtentLength = extLength
+			}
+		}
+
+		if uint32(id) == itemID {
+			if constructionMethod != 0 {
+				return 0, 0, fmt.Errorf("unsupported iloc construction method %d", constructionMethod)
+			}
+			return int64(baseOffset + firstExtentOffset), int64(firstExtentLength), nil
+		}
+	}
+
+	return 0, 0, errors.New("item ID not found in iloc box")
+}
@@ -0,0 +1,183 @@
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+)
+
+// buildHEICWithGPS assembles a minimal HEIC/HEIF file: ftyp, a meta box whose
+// iinf/iloc tables describe a single "Exif" item located by absolute file
+// offset (construction_method 0), and an mdat box holding that item's bytes
+// (the HEIF Exif-item TIFF-header-offset field, "Exif\0\0", then a GPS IFD)
+// followed by fake image data.
+func buildHEICWithGPS(t *testing.T) []byte {
+	t.Helper()
+	be := binary.BigEndian
+
+	box := func(boxType string, content []byte) []byte {
+		var b bytes.Buffer
+		_ = binary.Write(&b, be, uint32(8+len(content)))
+		b.WriteString(boxType)
+		b.Write(content)
+		return b.Bytes()
+	}
+
+	var ftypContent bytes.Buffer
+	ftypContent.WriteString("heic")
+	_ = binary.Write(&ftypContent, be, uint32(0))
+	ftypContent.WriteString("mif1")
+	ftypContent.WriteString("heic")
+	ftyp := box("ftyp", ftypContent.Bytes())
+
+	// infe (version 2): FullBox header, item_ID, protection_index, item_type.
+	var infeContent bytes.Buffer
+	infeContent.WriteByte(2)        // version
+	infeContent.Write([]byte{0, 0, 0}) // flags
+	_ = binary.Write(&infeContent, be, uint16(1)) // item_ID
+	_ = binary.Write(&infeContent, be, uint16(0)) // protection_index
+	infeContent.WriteString("Exif")               // item_type
+	infe := box("infe", infeContent.Bytes())
+
+	// iinf: FullBox header, entry_count (uint16, version 0), then infe.
+	var iinfContent bytes.Buffer
+	iinfContent.WriteByte(0)
+	iinfContent.Write([]byte{0, 0, 0})
+	_ = binary.Write(&iinfContent, be, uint16(1))
+	iinfContent.Write(infe)
+	iinf := box("iinf", iinfContent.Bytes())
+
+	// Everything up to the mdat box's content is fixed size once ftyp/meta are
+	// built, so the Exif item's absolute file offset can be computed before
+	// the iloc box (which embeds that offset) is assembled.
+	const offsetSize, lengthSize = 4, 4
+
+	buildItemLocation := func(itemOffset, itemLength uint32) []byte {
+		var ilocContent bytes.Buffer
+		ilocContent.WriteByte(0) // version
+		ilocContent.Write([]byte{0, 0, 0})
+		ilocContent.WriteByte(offsetSize<<4 | lengthSize) // offset_size | length_size
+		ilocContent.WriteByte(0)                          // base_offset_size=0, index_size=0
+		_ = binary.Write(&ilocContent, be, uint16(1))      // item_count
+
+		_ = binary.Write(&ilocContent, be, uint16(1)) // item_ID
+		_ = binary.Write(&ilocContent, be, uint16(0)) // data_reference_index
+		// base_offset omitted: base_offset_size == 0
+		_ = binary.Write(&ilocContent, be, uint16(1)) // extent_count
+		_ = binary.Write(&ilocContent, be, itemOffset)
+		_ = binary.Write(&ilocContent, be, itemLength)
+		return box("iloc", ilocContent.Bytes())
+	}
+
+	metaSize := func(ilocLen int) int {
+		metaContent := 4 + len(iinf) + ilocLen // FullBox header + iinf + iloc
+		return 8 + metaContent
+	}
+
+	// Placeholder iloc just to measure its length (fixed regardless of the
+	// offset/length values plugged in above).
+	placeholderIloc := buildItemLocation(0, 0)
+	mdatContentOffset := len(ftyp) + metaSize(len(placeholderIloc)) + 8
+
+	exifHeaderOffset := uint32(6) // "Exif\0\0" sits right after this 4-byte field
+	tiff := buildTIFFWithGPS(t)
+
+	var exifItem bytes.Buffer
+	_ = binary.Write(&exifItem, be, exifHeaderOffset)
+	exifItem.WriteString("Exif\x00\x00")
+	exifItem.Write(tiff)
+
+	iloc := buildItemLocation(uint32(mdatContentOffset), uint32(exifItem.Len()))
+	if len(iloc) != len(placeholderIloc) {
+		t.Fatalf("iloc size changed after plugging in offsets: %d != %d", len(iloc), len(placeholderIloc))
+	}
+
+	var metaContent bytes.Buffer
+	_ = binary.Write(&metaContent, be, uint32(0)) // meta's own FullBox version/flags
+	metaContent.Write(iinf)
+	metaContent.Write(iloc)
+	meta := box("meta", metaContent.Bytes())
+
+	var mdatContent bytes.Buffer
+	mdatContent.Write(exifItem.Bytes())
+	mdatContent.WriteString("fake-image-data")
+	mdat := box("mdat", mdatContent.Bytes())
+
+	var out bytes.Buffer
+	out.Write(ftyp)
+	out.Write(meta)
+	out.Write(mdat)
+	return out.Bytes()
+}
+
+func TestFilterHEICExtractsGPS(t *testing.T) {
+	data := buildHEICWithGPS(t)
+
+	out, info, err := FilterHEIC(bytes.NewReader(data), StripNone)
+	if err != nil {
+		t.Fatalf("FilterHEIC returned error: %v", err)
+	}
+	if !info.HasGPS {
+		t.Fatal("expected HasGPS to be true")
+	}
+	if info.Latitude < 37.77 || info.Latitude > 37.78 {
+		t.Errorf("Latitude = %v, want ~37.7749", info.Latitude)
+	}
+	if info.Longitude > -122.41 || info.Longitude < -122.43 {
+		t.Errorf("Longitude = %v, want ~-122.4194", info.Longitude)
+	}
+
+	got, err := io.ReadAll(out)
+	if err != nil {
+		t.Fatalf("failed to read filtered output: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("StripNone should not modify the output bytes")
+	}
+}
+
+func TestFilterHEICStripsGPS(t *testing.T) {
+	data := buildHEICWithGPS(t)
+
+	out, info, err := FilterHEIC(bytes.NewReader(data), StripGPS)
+	if err != nil {
+		t.Fatalf("FilterHEIC returned error: %v", err)
+	}
+	if !info.HasGPS {
+		t.Fatal("expected extraction to still report HasGPS before stripping")
+	}
+
+	got, err := io.ReadAll(out)
+	if err != nil {
+		t.Fatalf("failed to read filtered output: %v", err)
+	}
+	if len(got) != len(data) {
+		t.Fatalf("expected stripping in place to preserve file length: got %d, want %d", len(got), len(data))
+	}
+
+	out2, info2, err := FilterHEIC(bytes.NewReader(got), StripNone)
+	if err != nil {
+		t.Fatalf("FilterHEIC on stripped output returned error: %v", err)
+	}
+	io.ReadAll(out2)
+	if info2.HasGPS {
+		t.Error("expected GPS data to be unreadable after StripGPS")
+	}
+}
+
+func TestFilterHEICPassesThroughOnParseFailure(t *testing.T) {
+	data := []byte("this is not a valid HEIC file at all, just plain bytes")
+
+	out, _, err := FilterHEIC(bytes.NewReader(data), StripNone)
+	if err == nil {
+		t.Fatal("expected an error for unparseable input")
+	}
+	got, readErr := io.ReadAll(out)
+	if readErr != nil {
+		t.Fatalf("failed to read passthrough output: %v", readErr)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("expected unparseable input to be passed through byte-for-byte")
+	}
+}
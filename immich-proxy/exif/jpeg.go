@@ -0,0 +1,97 @@
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// exifHeader is the fixed prefix of an APP1 segment's payload that marks it
+// as EXIF (as opposed to e.g. XMP, which also lives in APP1).
+const exifHeader = "Exif\x00\x00"
+
+// FilterJPEG scans the JPEG segments in r up to the start of the compressed
+// scan data (where EXIF APP1 segments live) and, depending on mode, rewrites
+// or drops the EXIF segment. Only that header portion is buffered in memory;
+// the compressed scan data that follows is streamed through untouched. On
+// error the returned reader still reproduces r byte-for-byte, so callers can
+// fall back to passing the asset through unmodified.
+func FilterJPEG(r io.Reader, mode StripMode) (io.Reader, *Info, error) {
+	var raw, out bytes.Buffer
+	info := &Info{}
+
+	read := func(n int) ([]byte, error) {
+		buf := make([]byte, n)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		raw.Write(buf)
+		return buf, nil
+	}
+	onError := func(err error) (io.Reader, *Info, error) {
+		return io.MultiReader(&raw, r), info, err
+	}
+
+	soi, err := read(2)
+	if err != nil {
+		return onError(fmt.Errorf("failed to read SOI marker: %w", err))
+	}
+	if soi[0] != 0xFF || soi[1] != 0xD8 {
+		return onError(errors.New("not a JPEG file"))
+	}
+	out.Write(soi)
+
+	for {
+		marker, err := read(2)
+		if err != nil {
+			return onError(fmt.Errorf("failed to read segment marker: %w", err))
+		}
+		if marker[0] != 0xFF {
+			return onError(errors.New("invalid JPEG marker"))
+		}
+
+		// TEM and RSTn carry no length/payload.
+		if marker[1] == 0x01 || (marker[1] >= 0xD0 && marker[1] <= 0xD7) {
+			out.Write(marker)
+			continue
+		}
+
+		// SOS/EOI: everything from here on is scan data (or nothing); stream
+		// the remainder through untouched instead of buffering it.
+		if marker[1] == 0xDA || marker[1] == 0xD9 {
+			out.Write(marker)
+			return io.MultiReader(&out, r), info, nil
+		}
+
+		lenBuf, err := read(2)
+		if err != nil {
+			return onError(fmt.Errorf("failed to read segment length: %w", err))
+		}
+		segLen := binary.BigEndian.Uint16(lenBuf)
+		if segLen < 2 {
+			return onError(errors.New("invalid segment length"))
+		}
+		payload, err := read(int(segLen) - 2)
+		if err != nil {
+			return onError(fmt.Errorf("failed to read segment payload: %w", err))
+		}
+
+		if marker[1] == 0xE1 && bytes.HasPrefix(payload, []byte(exifHeader)) {
+			tiff := payload[len(exifHeader):]
+			extractGPSAndTime(tiff, info)
+
+			switch mode {
+			case StripAll:
+				continue // drop the whole APP1 Exif segment from the output
+			case StripGPS:
+				stripGPS(tiff)
+			}
+		}
+
+		out.Write(marker)
+		out.Write(lenBuf)
+		out.Write(payload)
+	}
+}
@@ -0,0 +1,99 @@
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+)
+
+// buildJPEGWithGPS assembles a minimal JPEG: SOI, an APP1 Exif segment
+// encoding a GPS IFD (37.7749 N, 122.4194 W), then SOS + fake scan bytes.
+func buildJPEGWithGPS(t *testing.T) []byte {
+	t.Helper()
+
+	var app1 bytes.Buffer
+	app1.WriteString(exifHeader)
+	app1.Write(buildTIFFWithGPS(t))
+
+	var jpeg bytes.Buffer
+	jpeg.Write([]byte{0xFF, 0xD8})
+	jpeg.Write([]byte{0xFF, 0xE1})
+	_ = binary.Write(&jpeg, binary.BigEndian, uint16(app1.Len()+2))
+	jpeg.Write(app1.Bytes())
+	jpeg.Write([]byte{0xFF, 0xDA})
+	jpeg.WriteString("fake-scan-data")
+
+	return jpeg.Bytes()
+}
+
+func TestFilterJPEGExtractsGPS(t *testing.T) {
+	data := buildJPEGWithGPS(t)
+
+	out, info, err := FilterJPEG(bytes.NewReader(data), StripNone)
+	if err != nil {
+		t.Fatalf("FilterJPEG returned error: %v", err)
+	}
+	if !info.HasGPS {
+		t.Fatal("expected HasGPS to be true")
+	}
+	if info.Latitude < 37.77 || info.Latitude > 37.78 {
+		t.Errorf("Latitude = %v, want ~37.7749", info.Latitude)
+	}
+	if info.Longitude > -122.41 || info.Longitude < -122.43 {
+		t.Errorf("Longitude = %v, want ~-122.4194", info.Longitude)
+	}
+
+	got, err := io.ReadAll(out)
+	if err != nil {
+		t.Fatalf("failed to read filtered output: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("StripNone should not modify the output bytes")
+	}
+}
+
+func TestFilterJPEGStripsGPS(t *testing.T) {
+	data := buildJPEGWithGPS(t)
+
+	out, info, err := FilterJPEG(bytes.NewReader(data), StripGPS)
+	if err != nil {
+		t.Fatalf("FilterJPEG returned error: %v", err)
+	}
+	if !info.HasGPS {
+		t.Fatal("expected extraction to still report HasGPS before stripping")
+	}
+
+	got, err := io.ReadAll(out)
+	if err != nil {
+		t.Fatalf("failed to read filtered output: %v", err)
+	}
+
+	out2, info2, err := FilterJPEG(bytes.NewReader(got), StripNone)
+	if err != nil {
+		t.Fatalf("FilterJPEG on stripped output returned error: %v", err)
+	}
+	io.ReadAll(out2)
+	if info2.HasGPS {
+		t.Error("expected GPS data to be unreadable after StripGPS")
+	}
+}
+
+func TestFilterJPEGDropsExifSegmentOnStripAll(t *testing.T) {
+	data := buildJPEGWithGPS(t)
+
+	out, _, err := FilterJPEG(bytes.NewReader(data), StripAll)
+	if err != nil {
+		t.Fatalf("FilterJPEG returned error: %v", err)
+	}
+	got, err := io.ReadAll(out)
+	if err != nil {
+		t.Fatalf("failed to read filtered output: %v", err)
+	}
+	if bytes.Contains(got, []byte(exifHeader)) {
+		t.Error("expected StripAll to remove the Exif APP1 segment entirely")
+	}
+	if !bytes.Contains(got, []byte("fake-scan-data")) {
+		t.Error("expected scan data to be preserved")
+	}
+}
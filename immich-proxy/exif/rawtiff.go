@@ -0,0 +1,44 @@
+package exif
+
+import (
+	"bytes"
+	"errors"
+	"io"
+)
+
+// maxTIFFHeaderBuffer bounds how much of a raw TIFF/DNG file FilterTIFF will
+// buffer to locate IFD0/ExifIFD/GPS IFD entries and their values. Unlike a
+// JPEG's bounded APP1 segment, TIFF doesn't delimit where metadata ends and
+// pixel data begins, and DNG raw sensor data can run to many megabytes, so
+// the whole file can't be buffered the way FilterJPEG buffers just the
+// header. In practice camera-written GPS/time tags and their small
+// rational/ASCII values sit within the first few kilobytes of the file, well
+// inside this cap.
+const maxTIFFHeaderBuffer = 1 << 20 // 1MiB
+
+// FilterTIFF handles a raw TIFF/DNG payload, i.e. a file whose TIFF header
+// starts at byte 0 rather than being wrapped in a JPEG APP1 segment or a
+// HEIC item. It buffers up to maxTIFFHeaderBuffer bytes, runs the same
+// IFD-walking extraction/stripping used for JPEG's embedded TIFF, and streams
+// anything beyond the cap through untouched.
+func FilterTIFF(r io.Reader, mode StripMode) (io.Reader, *Info, error) {
+	info := &Info{}
+
+	buf := make([]byte, maxTIFFHeaderBuffer)
+	n, err := io.ReadFull(r, buf)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return io.MultiReader(bytes.NewReader(buf[:n]), r), info, err
+	}
+	header := buf[:n]
+
+	extractGPSAndTime(header, info)
+
+	switch mode {
+	case StripAll:
+		stripAllTags(header)
+	case StripGPS:
+		stripGPS(header)
+	}
+
+	return io.MultiReader(bytes.NewReader(header), r), info, nil
+}
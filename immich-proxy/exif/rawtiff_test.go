@@ -0,0 +1,97 @@
+package exif
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestFilterTIFFExtractsGPS(t *testing.T) {
+	data := buildTIFFWithGPS(t)
+
+	out, info, err := FilterTIFF(bytes.NewReader(data), StripNone)
+	if err != nil {
+		t.Fatalf("FilterTIFF returned error: %v", err)
+	}
+	if !info.HasGPS {
+		t.Fatal("expected HasGPS to be true")
+	}
+	if info.Latitude < 37.77 || info.Latitude > 37.78 {
+		t.Errorf("Latitude = %v, want ~37.7749", info.Latitude)
+	}
+	if info.Longitude > -122.41 || info.Longitude < -122.43 {
+		t.Errorf("Longitude = %v, want ~-122.4194", info.Longitude)
+	}
+
+	got, err := io.ReadAll(out)
+	if err != nil {
+		t.Fatalf("failed to read filtered output: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("StripNone should not modify the output bytes")
+	}
+}
+
+func TestFilterTIFFStripsGPS(t *testing.T) {
+	data := buildTIFFWithGPS(t)
+
+	out, info, err := FilterTIFF(bytes.NewReader(data), StripGPS)
+	if err != nil {
+		t.Fatalf("FilterTIFF returned error: %v", err)
+	}
+	if !info.HasGPS {
+		t.Fatal("expected extraction to still report HasGPS before stripping")
+	}
+
+	got, err := io.ReadAll(out)
+	if err != nil {
+		t.Fatalf("failed to read filtered output: %v", err)
+	}
+
+	out2, info2, err := FilterTIFF(bytes.NewReader(got), StripNone)
+	if err != nil {
+		t.Fatalf("FilterTIFF on stripped output returned error: %v", err)
+	}
+	io.ReadAll(out2)
+	if info2.HasGPS {
+		t.Error("expected GPS data to be unreadable after StripGPS")
+	}
+}
+
+func TestFilterTIFFStripAllHidesIFD0(t *testing.T) {
+	data := buildTIFFWithGPS(t)
+
+	out, _, err := FilterTIFF(bytes.NewReader(data), StripAll)
+	if err != nil {
+		t.Fatalf("FilterTIFF returned error: %v", err)
+	}
+	got, err := io.ReadAll(out)
+	if err != nil {
+		t.Fatalf("failed to read filtered output: %v", err)
+	}
+
+	out2, info2, err := FilterTIFF(bytes.NewReader(got), StripNone)
+	if err != nil {
+		t.Fatalf("FilterTIFF on stripped output returned error: %v", err)
+	}
+	io.ReadAll(out2)
+	if info2.HasGPS {
+		t.Error("expected StripAll to make IFD0's tags (and its GPS sub-IFD) unreachable")
+	}
+}
+
+func TestFilterTIFFPassesThroughNonTIFFBytes(t *testing.T) {
+	data := []byte("II*\x00not actually a valid TIFF body")
+
+	out, _, err := FilterTIFF(bytes.NewReader(data), StripNone)
+	if err != nil {
+		t.Fatalf("FilterTIFF returned error: %v", err)
+	}
+	got, err := io.ReadAll(out)
+	if err != nil {
+		t.Fatalf("failed to read filtered output: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("expected unparseable input to be passed through byte-for-byte")
+	}
+}
@@ -0,0 +1,177 @@
+package exif
+
+import (
+	"encoding/binary"
+	"errors"
+	"strings"
+)
+
+// TIFF/EXIF tag IDs this package cares about.
+const (
+	tagExifIFDPointer   = 0x8769
+	tagGPSIFDPointer    = 0x8825
+	tagDateTimeOriginal = 0x9003
+
+	tagGPSLatitudeRef  = 0x0001
+	tagGPSLatitude     = 0x0002
+	tagGPSLongitudeRef = 0x0003
+	tagGPSLongitude    = 0x0004
+)
+
+// TIFF field types, from the EXIF spec.
+const (
+	typeByte      = 1
+	typeASCII     = 2
+	typeShort     = 3
+	typeLong      = 4
+	typeRational  = 5
+	typeUndefined = 7
+	typeSRational = 10
+)
+
+// ifdEntry is one 12-byte IFD directory entry: a tag, its type and count, and
+// either the value itself or an offset to it, depending on size.
+type ifdEntry struct {
+	tag    uint16
+	typ    uint16
+	count  uint32
+	raw    [4]byte // the value/offset field exactly as stored in the file
+	offset int      // byte offset of the value/offset field within tiff
+}
+
+// parseTIFFHeader reads the byte-order marker and IFD0 offset from the start
+// of an EXIF payload (i.e. the bytes immediately following "Exif\0\0").
+func parseTIFFHeader(tiff []byte) (binary.ByteOrder, uint32, error) {
+	if len(tiff) < 8 {
+		return nil, 0, errors.New("TIFF header too short")
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[0:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, 0, errors.New("unrecognized TIFF byte order marker")
+	}
+
+	if order.Uint16(tiff[2:4]) != 0x002A {
+		return nil, 0, errors.New("invalid TIFF magic number")
+	}
+
+	return order, order.Uint32(tiff[4:8]), nil
+}
+
+// readIFD reads the directory entries at offset and returns them along with
+// the offset of the next IFD (0 if there is none).
+func readIFD(tiff []byte, order binary.ByteOrder, offset uint32) ([]ifdEntry, uint32, error) {
+	if int(offset)+2 > len(tiff) {
+		return nil, 0, errors.New("IFD offset out of range")
+	}
+
+	count := order.Uint16(tiff[offset : offset+2])
+	entries := make([]ifdEntry, 0, count)
+	pos := int(offset) + 2
+
+	for i := 0; i < int(count); i++ {
+		if pos+12 > len(tiff) {
+			return nil, 0, errors.New("IFD entry out of range")
+		}
+		e := ifdEntry{
+			tag:    order.Uint16(tiff[pos : pos+2]),
+			typ:    order.Uint16(tiff[pos+2 : pos+4]),
+			count:  order.Uint32(tiff[pos+4 : pos+8]),
+			offset: pos + 8,
+		}
+		copy(e.raw[:], tiff[pos+8:pos+12])
+		entries = append(entries, e)
+		pos += 12
+	}
+
+	var next uint32
+	if pos+4 <= len(tiff) {
+		next = order.Uint32(tiff[pos : pos+4])
+	}
+	return entries, next, nil
+}
+
+// asUint32 interprets the entry's value/offset field as a LONG, which is how
+// IFD pointer tags (ExifIFDPointer, GPSInfoIFDPointer) are encoded.
+func (e ifdEntry) asUint32(order binary.ByteOrder) uint32 {
+	return order.Uint32(e.raw[:])
+}
+
+// valueBytes returns the entry's raw value bytes, resolving the offset
+// indirection for values too large to fit inline.
+func (e ifdEntry) valueBytes(tiff []byte, order binary.ByteOrder) []byte {
+	size := typeSize(e.typ) * int(e.count)
+	if size <= 4 {
+		return e.raw[:minInt(size, 4)]
+	}
+	offset := int(e.asUint32(order))
+	if offset+size > len(tiff) || offset < 0 {
+		return nil
+	}
+	return tiff[offset : offset+size]
+}
+
+func (e ifdEntry) asASCII(tiff []byte, order binary.ByteOrder) string {
+	return strings.TrimRight(string(e.valueBytes(tiff, order)), "\x00")
+}
+
+func typeSize(typ uint16) int {
+	switch typ {
+	case typeShort:
+		return 2
+	case typeLong:
+		return 4
+	case typeRational, typeSRational:
+		return 8
+	default: // ASCII, BYTE, UNDEFINED
+		return 1
+	}
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// rational is an EXIF unsigned rational: Num/Den.
+type rational struct {
+	Num, Den uint32
+}
+
+func (r rational) Float() float64 {
+	if r.Den == 0 {
+		return 0
+	}
+	return float64(r.Num) / float64(r.Den)
+}
+
+func readRationals(data []byte, order binary.ByteOrder, n int) []rational {
+	out := make([]rational, 0, n)
+	for i := 0; i < n && (i+1)*8 <= len(data); i++ {
+		out = append(out, rational{
+			Num: order.Uint32(data[i*8 : i*8+4]),
+			Den: order.Uint32(data[i*8+4 : i*8+8]),
+		})
+	}
+	return out
+}
+
+// dmsToDecimal converts a GPS degrees/minutes/seconds rational triple and
+// its N/S/E/W reference byte into signed decimal degrees.
+func dmsToDecimal(dms []rational, ref byte) float64 {
+	if len(dms) < 3 {
+		return 0
+	}
+	decimal := dms[0].Float() + dms[1].Float()/60 + dms[2].Float()/3600
+	if ref == 'S' || ref == 'W' {
+		decimal = -decimal
+	}
+	return decimal
+}
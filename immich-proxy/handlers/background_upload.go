@@ -1,49 +1,28 @@
 package handlers
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
 	"mime/multipart"
 	"net/http"
 	"net/textproto"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
-)
-
-// GetClientIP extracts the real client IP from the request.
-// It checks X-Forwarded-For and X-Real-IP headers first (for proxy scenarios),
-// then falls back to RemoteAddr.
-func GetClientIP(r *http.Request) string {
-	// Check X-Forwarded-For header first (may contain multiple IPs)
-	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-		// X-Forwarded-For can contain multiple IPs: client, proxy1, proxy2...
-		// The first IP is typically the original client
-		ips := strings.Split(xff, ",")
-		if len(ips) > 0 {
-			clientIP := strings.TrimSpace(ips[0])
-			if clientIP != "" {
-				return clientIP
-			}
-		}
-	}
 
-	// Check X-Real-IP header (set by NGINX)
-	if xri := r.Header.Get("X-Real-IP"); xri != "" {
-		return xri
-	}
-
-	// Check CF-Connecting-IP header (Cloudflare)
-	if cfIP := r.Header.Get("CF-Connecting-IP"); cfIP != "" {
-		return cfIP
-	}
+	"immich-proxy/exif"
+	"immich-proxy/logx"
+	"immich-proxy/metrics"
+	"immich-proxy/proxy"
+)
 
-	// Fall back to RemoteAddr
-	return r.RemoteAddr
-}
+// uploadCopyBufferSize bounds the buffer used to stream asset data into the
+// outbound multipart body so multi-gigabyte uploads don't balloon memory use.
+const uploadCopyBufferSize = 256 * 1024
 
 // BackgroundUploadRequest represents the metadata for background upload
 // These are passed as URL query parameters or custom headers since
@@ -85,90 +64,127 @@ type BackgroundUploadResponse struct {
 // BackgroundUploadHandler handles the background upload endpoint
 // This endpoint receives raw photo/video data and converts it to
 // the multipart/form-data format expected by Immich
-func BackgroundUploadHandler(immichServerURL string) http.HandlerFunc {
+func BackgroundUploadHandler(immichServerURL string, stripMode exif.StripMode, ipResolver *proxy.ClientIPResolver) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		clientIP := GetClientIP(r)
+		clientIP := ipResolver.Resolve(r)
 
 		if r.Method != http.MethodPost {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
 
-		log.Printf("[%s] Background upload request received", clientIP)
+		logx.Info("background upload request received", "client_ip", clientIP)
 
 		// Extract metadata from headers (since body contains raw photo data)
 		metadata := extractMetadata(r)
-		log.Printf("[%s] Metadata: %+v", clientIP, metadata)
+		logx.Info("background upload metadata", "client_ip", clientIP, "metadata", metadata)
 
-		// Read the raw photo data from request body
-		photoData, err := io.ReadAll(r.Body)
+		defer r.Body.Close()
+
+		status, respHeader, responseBody, err := forwardAssetUpload(r.Context(), immichServerURL, metadata, r.Body, r.Header.Get("x-api-key"), stripMode)
 		if err != nil {
-			log.Printf("[%s] Failed to read request body: %v", clientIP, err)
-			http.Error(w, "Failed to read request body", http.StatusBadRequest)
+			logx.Error("failed to forward request to Immich", "client_ip", clientIP, "err", err)
+			http.Error(w, "Failed to forward request to Immich", http.StatusBadGateway)
 			return
 		}
-		defer r.Body.Close()
 
-		log.Printf("[%s] Received %d bytes of photo data", clientIP, len(photoData))
+		logx.Info("immich response", "client_ip", clientIP, "status", status, "body", string(responseBody))
 
-		// Create multipart form data for Immich
-		body, contentType, err := createMultipartRequest(metadata, photoData)
-		if err != nil {
-			log.Printf("[%s] Failed to create multipart request: %v", clientIP, err)
-			http.Error(w, "Failed to create multipart request", http.StatusInternalServerError)
-			return
+		// Copy response headers
+		for key, values := range respHeader {
+			for _, value := range values {
+				w.Header().Add(key, value)
+			}
 		}
 
-		// Forward to Immich server
-		immichURL := fmt.Sprintf("%s/api/assets", immichServerURL)
-		req, err := http.NewRequest(http.MethodPost, immichURL, body)
+		w.WriteHeader(status)
+		w.Write(responseBody)
+	}
+}
+
+// forwardAssetUpload sanitizes and streams assetData into a multipart request
+// and POSTs it to the Immich server's asset upload endpoint, returning the
+// upstream response status, headers, and body. It is shared by
+// BackgroundUploadHandler and TusUploadHandler's finalize step so both paths
+// forward assets the same way, including EXIF handling and metadata defaults.
+func forwardAssetUpload(ctx context.Context, immichServerURL string, metadata BackgroundUploadRequest, assetData io.Reader, apiKey string, stripMode exif.StripMode) (status int, respHeader http.Header, responseBody []byte, err error) {
+	metrics.InflightUploads.Inc()
+	defer metrics.InflightUploads.Dec()
+
+	start := time.Now()
+	var bytesRead int64
+	defer func() {
+		outcome := "success"
 		if err != nil {
-			log.Printf("[%s] Failed to create request: %v", clientIP, err)
-			http.Error(w, "Failed to create request", http.StatusInternalServerError)
-			return
+			outcome = "error"
 		}
+		metrics.BackgroundUploadDuration.WithLabelValues(outcome).Observe(time.Since(start).Seconds())
+		metrics.BackgroundUploadBytes.Observe(float64(atomic.LoadInt64(&bytesRead)))
+	}()
 
-		// Set headers
-		req.Header.Set("Content-Type", contentType)
-		req.Header.Set("Accept", "application/json")
+	assetData, info := exif.Process(assetData, stripMode)
+	backfillMetadataFromEXIF(&metadata, info)
+	applyMetadataDefaults(&metadata)
 
-		// Forward the API key from the original request
-		if apiKey := r.Header.Get("x-api-key"); apiKey != "" {
-			req.Header.Set("x-api-key", apiKey)
-		}
+	assetData = &countingReader{r: assetData, n: &bytesRead}
 
-		// Send request to Immich
-		client := &http.Client{
-			Timeout: 5 * time.Minute, // Large files may take time
-		}
-		resp, err := client.Do(req)
-		if err != nil {
-			log.Printf("[%s] Failed to forward request to Immich: %v", clientIP, err)
-			http.Error(w, "Failed to forward request to Immich", http.StatusBadGateway)
-			return
-		}
-		defer resp.Body.Close()
+	// Stream the multipart form data for Immich directly from the
+	// caller's reader instead of buffering the whole asset in memory
+	body, contentType, err := createMultipartRequest(ctx, metadata, assetData)
+	if err != nil {
+		return 0, nil, nil, fmt.Errorf("failed to create multipart request: %w", err)
+	}
 
-		// Copy response from Immich back to client
-		responseBody, err := io.ReadAll(resp.Body)
-		if err != nil {
-			log.Printf("[%s] Failed to read Immich response: %v", clientIP, err)
-			http.Error(w, "Failed to read Immich response", http.StatusBadGateway)
-			return
-		}
+	immichURL := fmt.Sprintf("%s/api/assets", immichServerURL)
+	req, reqErr := http.NewRequestWithContext(ctx, http.MethodPost, immichURL, body)
+	if reqErr != nil {
+		return 0, nil, nil, fmt.Errorf("failed to create request: %w", reqErr)
+	}
 
-		log.Printf("[%s] Immich response status: %d, body: %s", clientIP, resp.StatusCode, string(responseBody))
+	// Set headers. ContentLength is left at 0 (unknown) so net/http
+	// sends the request chunked instead of buffering it to compute a length.
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Accept", "application/json")
+	req.TransferEncoding = []string{"chunked"}
 
-		// Copy response headers
-		for key, values := range resp.Header {
-			for _, value := range values {
-				w.Header().Add(key, value)
-			}
-		}
+	if apiKey != "" {
+		req.Header.Set("x-api-key", apiKey)
+	}
+	if requestID, ok := logx.RequestIDFromContext(ctx); ok {
+		req.Header.Set("X-Request-Id", requestID)
+	}
 
-		w.WriteHeader(resp.StatusCode)
-		w.Write(responseBody)
+	client := &http.Client{
+		Timeout: 5 * time.Minute, // Large files may take time
+	}
+	resp, doErr := client.Do(req)
+	if doErr != nil {
+		metrics.UpstreamErrorsTotal.Inc()
+		return 0, nil, nil, fmt.Errorf("failed to reach Immich: %w", doErr)
+	}
+	defer resp.Body.Close()
+	logx.SetUpstreamStatus(ctx, resp.StatusCode)
+
+	responseBody, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, nil, fmt.Errorf("failed to read Immich response: %w", err)
 	}
+
+	return resp.StatusCode, resp.Header, responseBody, nil
+}
+
+// countingReader wraps an io.Reader and tallies bytes read into n, so
+// forwardAssetUpload can report background_upload_bytes once the streamed
+// copy into the outbound multipart request finishes.
+type countingReader struct {
+	r io.Reader
+	n *int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	atomic.AddInt64(c.n, int64(n))
+	return n, err
 }
 
 // extractMetadata extracts upload metadata from request headers
@@ -220,7 +236,26 @@ func extractMetadata(r *http.Request) BackgroundUploadRequest {
 		metadata.Longitude = query.Get("longitude")
 	}
 
-	// Set defaults
+	return metadata
+}
+
+// backfillMetadataFromEXIF fills in GPS coordinates and the capture time from
+// the asset's own EXIF data when the iOS extension didn't supply them.
+func backfillMetadataFromEXIF(metadata *BackgroundUploadRequest, info *exif.Info) {
+	if metadata.Latitude == "" && metadata.Longitude == "" && info.HasGPS {
+		metadata.Latitude = strconv.FormatFloat(info.Latitude, 'f', -1, 64)
+		metadata.Longitude = strconv.FormatFloat(info.Longitude, 'f', -1, 64)
+	}
+	if metadata.FileCreatedAt == "" && info.DateTimeOriginal != "" {
+		if t, err := time.Parse("2006:01:02 15:04:05", info.DateTimeOriginal); err == nil {
+			metadata.FileCreatedAt = t.UTC().Format(time.RFC3339)
+		}
+	}
+}
+
+// applyMetadataDefaults fills in fields that iOS sometimes omits, shared by
+// the header/query based extractMetadata and the TUS upload path.
+func applyMetadataDefaults(metadata *BackgroundUploadRequest) {
 	if metadata.DeviceID == "" {
 		metadata.DeviceID = "ios-immich-uploader"
 	}
@@ -247,15 +282,27 @@ func extractMetadata(r *http.Request) BackgroundUploadRequest {
 	if metadata.FileModifiedAt == "" {
 		metadata.FileModifiedAt = now
 	}
-
-	return metadata
 }
 
-// createMultipartRequest creates the multipart/form-data request body for Immich
-func createMultipartRequest(metadata BackgroundUploadRequest, photoData []byte) (*bytes.Buffer, string, error) {
-	body := &bytes.Buffer{}
-	writer := multipart.NewWriter(body)
+// createMultipartRequest builds the multipart/form-data request body for Immich.
+// Instead of buffering the whole asset in memory, it drives a multipart.Writer
+// from a goroutine and streams the result through an io.Pipe, copying assetData
+// straight from the client's body in uploadCopyBufferSize chunks. Cancelling ctx
+// (e.g. the client aborting the upload) tears down the pipe on both ends.
+func createMultipartRequest(ctx context.Context, metadata BackgroundUploadRequest, assetData io.Reader) (io.Reader, string, error) {
+	pr, pw := io.Pipe()
+	writer := multipart.NewWriter(pw)
+
+	go func() {
+		pw.CloseWithError(writeMultipartBody(ctx, writer, pw, metadata, assetData))
+	}()
 
+	return pr, writer.FormDataContentType(), nil
+}
+
+// writeMultipartBody writes the form fields and streamed asset data into writer,
+// aborting early if ctx is cancelled while the copy is in flight.
+func writeMultipartBody(ctx context.Context, writer *multipart.Writer, pw *io.PipeWriter, metadata BackgroundUploadRequest, assetData io.Reader) error {
 	// Add form fields
 	fields := map[string]string{
 		"deviceAssetId":  metadata.DeviceAssetID,
@@ -267,7 +314,7 @@ func createMultipartRequest(metadata BackgroundUploadRequest, photoData []byte)
 
 	for key, value := range fields {
 		if err := writer.WriteField(key, value); err != nil {
-			return nil, "", fmt.Errorf("failed to write field %s: %w", key, err)
+			return fmt.Errorf("failed to write field %s: %w", key, err)
 		}
 	}
 
@@ -283,12 +330,12 @@ func createMultipartRequest(metadata BackgroundUploadRequest, photoData []byte)
 			},
 		}
 		metadataJSON, err := json.Marshal([]RemoteAssetMetadataItem{metadataItem})
-			if err != nil {
-				return nil, "", fmt.Errorf("failed to marshal metadata: %w", err)
-			}
-			if err := writer.WriteField("metadata", string(metadataJSON)); err != nil {
-				return nil, "", fmt.Errorf("failed to write metadata field: %w", err)
-			}
+		if err != nil {
+			return fmt.Errorf("failed to marshal metadata: %w", err)
+		}
+		if err := writer.WriteField("metadata", string(metadataJSON)); err != nil {
+			return fmt.Errorf("failed to write metadata field: %w", err)
+		}
 	}
 
 	// Add the file with proper Content-Type
@@ -298,18 +345,33 @@ func createMultipartRequest(metadata BackgroundUploadRequest, photoData []byte)
 
 	part, err := writer.CreatePart(h)
 	if err != nil {
-		return nil, "", fmt.Errorf("failed to create form file: %w", err)
+		return fmt.Errorf("failed to create form file: %w", err)
 	}
 
-	if _, err := part.Write(photoData); err != nil {
-		return nil, "", fmt.Errorf("failed to write photo data: %w", err)
+	buf := make([]byte, uploadCopyBufferSize)
+	if _, err := io.CopyBuffer(part, contextReader{ctx: ctx, r: assetData}, buf); err != nil {
+		return fmt.Errorf("failed to stream photo data: %w", err)
 	}
 
 	if err := writer.Close(); err != nil {
-		return nil, "", fmt.Errorf("failed to close multipart writer: %w", err)
+		return fmt.Errorf("failed to close multipart writer: %w", err)
 	}
 
-	return body, writer.FormDataContentType(), nil
+	return nil
+}
+
+// contextReader wraps an io.Reader and aborts the read with ctx.Err() once ctx
+// is cancelled, so a client disconnect tears down the streaming pipe promptly.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr contextReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
 }
 
 // guessContentType guesses the content type based on file extension
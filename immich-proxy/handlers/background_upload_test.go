@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"strings"
+	"testing"
+)
+
+func TestCreateMultipartRequestStreamsAssetData(t *testing.T) {
+	metadata := BackgroundUploadRequest{
+		DeviceAssetID:  "asset-1",
+		DeviceID:       "device-1",
+		FileCreatedAt:  "2026-07-30T00:00:00Z",
+		FileModifiedAt: "2026-07-30T00:00:00Z",
+		IsFavorite:     "false",
+		Filename:       "photo.jpg",
+		ContentType:    "image/jpeg",
+		ICloudId:       "icloud-1",
+		Latitude:       "1.23",
+		Longitude:      "4.56",
+	}
+
+	assetData := strings.Repeat("a", uploadCopyBufferSize+1024)
+	body, contentType, err := createMultipartRequest(context.Background(), metadata, strings.NewReader(assetData))
+	if err != nil {
+		t.Fatalf("createMultipartRequest returned error: %v", err)
+	}
+
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		t.Fatalf("failed to parse content type %q: %v", contentType, err)
+	}
+
+	reader := multipart.NewReader(body, params["boundary"])
+	fields := map[string]string{}
+	var gotAssetData string
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("failed to read part: %v", err)
+		}
+
+		data, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatalf("failed to read part %q: %v", part.FormName(), err)
+		}
+
+		if part.FormName() == "assetData" {
+			gotAssetData = string(data)
+			continue
+		}
+		fields[part.FormName()] = string(data)
+	}
+
+	if gotAssetData != assetData {
+		t.Errorf("assetData mismatch: got %d bytes, want %d bytes", len(gotAssetData), len(assetData))
+	}
+	if fields["deviceAssetId"] != metadata.DeviceAssetID {
+		t.Errorf("deviceAssetId = %q, want %q", fields["deviceAssetId"], metadata.DeviceAssetID)
+	}
+	if fields["metadata"] == "" {
+		t.Error("expected metadata field to be populated when ICloudId is set")
+	}
+}
+
+func TestCreateMultipartRequestHonorsCancelledContext(t *testing.T) {
+	metadata := BackgroundUploadRequest{Filename: "photo.jpg", ContentType: "image/jpeg"}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	body, _, err := createMultipartRequest(ctx, metadata, strings.NewReader("data"))
+	if err != nil {
+		t.Fatalf("createMultipartRequest returned error: %v", err)
+	}
+
+	if _, err := io.ReadAll(body); err == nil {
+		t.Error("expected reading the pipe to fail after context cancellation, got nil error")
+	}
+}
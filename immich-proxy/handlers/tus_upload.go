@@ -0,0 +1,283 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"immich-proxy/exif"
+	"immich-proxy/logx"
+	"immich-proxy/proxy"
+)
+
+const (
+	tusResumableVersion = "1.0.0"
+	tusExtensions       = "creation,creation-with-upload,termination"
+)
+
+// TusUploadHandler implements the TUS 1.0 Core protocol (plus the creation,
+// creation-with-upload, and termination extensions) for background uploads.
+// iOS suspends and restarts PHBackgroundResourceUploadExtension sessions, so a
+// resumable upload lets a retry continue from the last acknowledged byte
+// instead of re-sending the whole asset.
+func TusUploadHandler(immichServerURL string, store UploadStore, basePath string, stripMode exif.StripMode, ipResolver *proxy.ClientIPResolver) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		clientIP := ipResolver.Resolve(r)
+		w.Header().Set("Tus-Resumable", tusResumableVersion)
+
+		id := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, basePath), "/")
+
+		switch r.Method {
+		case http.MethodPost:
+			if id != "" {
+				http.Error(w, "POST is only valid on the collection URL", http.StatusMethodNotAllowed)
+				return
+			}
+			handleTusCreate(w, r, immichServerURL, store, basePath, stripMode, clientIP)
+		case http.MethodHead:
+			handleTusHead(w, r, store, id)
+		case http.MethodPatch:
+			handleTusPatch(w, r, immichServerURL, store, id, stripMode, clientIP)
+		case http.MethodDelete:
+			handleTusDelete(w, store, id)
+		case http.MethodOptions:
+			w.Header().Set("Tus-Version", tusResumableVersion)
+			w.Header().Set("Tus-Extension", tusExtensions)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func handleTusCreate(w http.ResponseWriter, r *http.Request, immichServerURL string, store UploadStore, basePath string, stripMode exif.StripMode, clientIP string) {
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		http.Error(w, "Missing or invalid Upload-Length", http.StatusBadRequest)
+		return
+	}
+
+	values, err := parseUploadMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		http.Error(w, "Invalid Upload-Metadata", http.StatusBadRequest)
+		return
+	}
+	if apiKey := r.Header.Get("x-api-key"); apiKey != "" {
+		values["apiKey"] = apiKey
+	}
+
+	id, err := generateUploadID()
+	if err != nil {
+		logx.Error("failed to generate upload ID", "client_ip", clientIP, "err", err)
+		http.Error(w, "Failed to create upload", http.StatusInternalServerError)
+		return
+	}
+
+	info, err := store.Create(id, length, values)
+	if err != nil {
+		logx.Error("failed to create upload", "client_ip", clientIP, "upload_id", id, "err", err)
+		http.Error(w, "Failed to create upload", http.StatusInternalServerError)
+		return
+	}
+
+	// creation-with-upload: the client may send the first chunk with the POST
+	if r.Header.Get("Content-Type") == "application/offset+octet-stream" && r.ContentLength > 0 {
+		offset, err := store.Append(id, info.Offset, io.LimitReader(r.Body, length-info.Offset))
+		if err != nil {
+			logx.Error("failed to append initial chunk for upload", "client_ip", clientIP, "upload_id", id, "err", err)
+			http.Error(w, "Failed to append upload data", http.StatusInternalServerError)
+			return
+		}
+		info.Offset = offset
+		if info.Offset == info.Length {
+			finalizeTusUpload(r.Context(), immichServerURL, store, info, stripMode, clientIP)
+		}
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("%s/%s", strings.TrimSuffix(basePath, "/"), id))
+	w.Header().Set("Upload-Offset", strconv.FormatInt(info.Offset, 10))
+	w.WriteHeader(http.StatusCreated)
+}
+
+func handleTusHead(w http.ResponseWriter, r *http.Request, store UploadStore, id string) {
+	info, err := store.Info(id)
+	if err != nil {
+		http.Error(w, "Upload not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Upload-Offset", strconv.FormatInt(info.Offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(info.Length, 10))
+	w.WriteHeader(http.StatusOK)
+}
+
+func handleTusPatch(w http.ResponseWriter, r *http.Request, immichServerURL string, store UploadStore, id string, stripMode exif.StripMode, clientIP string) {
+	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		http.Error(w, "Unsupported Content-Type", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil {
+		http.Error(w, "Missing or invalid Upload-Offset", http.StatusBadRequest)
+		return
+	}
+
+	info, err := store.Info(id)
+	if err != nil {
+		http.Error(w, "Upload not found", http.StatusNotFound)
+		return
+	}
+	if info.AssetID != "" {
+		// Already finalized: report completion so a retried PATCH is idempotent.
+		w.Header().Set("Upload-Offset", strconv.FormatInt(info.Length, 10))
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if offset != info.Offset {
+		http.Error(w, "Upload-Offset does not match current offset", http.StatusConflict)
+		return
+	}
+
+	defer r.Body.Close()
+	newOffset, err := store.Append(id, offset, io.LimitReader(r.Body, info.Length-offset))
+	if err != nil {
+		logx.Error("failed to append to upload", "client_ip", clientIP, "upload_id", id, "err", err)
+		http.Error(w, "Failed to append upload data", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(newOffset, 10))
+
+	if newOffset == info.Length {
+		info.Offset = newOffset
+		finalizeTusUpload(r.Context(), immichServerURL, store, info, stripMode, clientIP)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func handleTusDelete(w http.ResponseWriter, store UploadStore, id string) {
+	if err := store.Delete(id); err != nil {
+		http.Error(w, "Failed to delete upload", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// finalizeTusUpload forwards the completed upload to Immich via the shared
+// multipart pipeline and records the returned asset ID so a duplicate
+// finalize call (e.g. a retried PATCH) becomes a no-op.
+func finalizeTusUpload(ctx context.Context, immichServerURL string, store UploadStore, info *UploadInfo, stripMode exif.StripMode, clientIP string) {
+	metadata := metadataFromTusValues(info.Metadata)
+
+	reader, err := store.Reader(info.ID)
+	if err != nil {
+		logx.Error("failed to open completed upload", "client_ip", clientIP, "upload_id", info.ID, "err", err)
+		return
+	}
+	defer reader.Close()
+
+	status, _, body, err := forwardAssetUpload(ctx, immichServerURL, metadata, reader, info.Metadata["apiKey"], stripMode)
+	if err != nil {
+		logx.Error("failed to finalize upload", "client_ip", clientIP, "upload_id", info.ID, "err", err)
+		return
+	}
+
+	var result BackgroundUploadResponse
+	if err := json.Unmarshal(body, &result); err != nil || result.ID == "" {
+		logx.Error("finalize upload got unparseable response body", "client_ip", clientIP, "upload_id", info.ID, "status", status, "body", string(body))
+		return
+	}
+
+	if err := store.SetAssetID(info.ID, result.ID); err != nil {
+		logx.Error("failed to persist asset ID for upload", "client_ip", clientIP, "upload_id", info.ID, "err", err)
+	}
+}
+
+// metadataFromTusValues maps the key/value pairs decoded from an Upload-Metadata
+// header onto BackgroundUploadRequest; forwardAssetUpload fills in defaults
+// and EXIF-derived fields afterward, the same as the header/query path.
+func metadataFromTusValues(values map[string]string) BackgroundUploadRequest {
+	metadata := BackgroundUploadRequest{
+		DeviceAssetID:  values["deviceAssetId"],
+		DeviceID:       values["deviceId"],
+		FileCreatedAt:  values["fileCreatedAt"],
+		FileModifiedAt: values["fileModifiedAt"],
+		IsFavorite:     values["isFavorite"],
+		Filename:       values["filename"],
+		ContentType:    values["contentType"],
+		ICloudId:       values["iCloudId"],
+		Latitude:       values["latitude"],
+		Longitude:      values["longitude"],
+	}
+	return metadata
+}
+
+// parseUploadMetadata decodes a TUS Upload-Metadata header of the form
+// "key1 base64value1,key2 base64value2,emptykey" into a plain map.
+func parseUploadMetadata(header string) (map[string]string, error) {
+	values := make(map[string]string)
+	if header == "" {
+		return values, nil
+	}
+
+	for _, pair := range strings.Split(header, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, " ", 2)
+		key := parts[0]
+		if len(parts) == 1 {
+			values[key] = ""
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode metadata value for %s: %w", key, err)
+		}
+		values[key] = string(decoded)
+	}
+	return values, nil
+}
+
+// generateUploadID returns a random hex-encoded upload ID.
+func generateUploadID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate random ID: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// StartUploadJanitor periodically deletes every upload created more than ttl
+// ago, finalized or not, so suspended iOS sessions that never resume don't
+// leak partial files on disk and completed uploads' files are removed too.
+func StartUploadJanitor(store UploadStore, ttl, interval time.Duration) {
+	go func() {
+		for range time.Tick(interval) {
+			stale, err := store.Stale(time.Now().UTC().Add(-ttl))
+			if err != nil {
+				logx.Error("upload janitor: failed to list stale uploads", "err", err)
+				continue
+			}
+			for _, id := range stale {
+				if err := store.Delete(id); err != nil {
+					logx.Error("upload janitor: failed to delete upload", "upload_id", id, "err", err)
+					continue
+				}
+				logx.Info("upload janitor: deleted stale upload", "upload_id", id)
+			}
+		}
+	}()
+}
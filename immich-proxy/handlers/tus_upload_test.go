@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"immich-proxy/exif"
+	"immich-proxy/proxy"
+)
+
+func TestParseUploadMetadata(t *testing.T) {
+	header := "filename cGhvdG8uanBn,deviceId ZGV2aWNlLTE=,isFavorite"
+
+	values, err := parseUploadMetadata(header)
+	if err != nil {
+		t.Fatalf("parseUploadMetadata returned error: %v", err)
+	}
+
+	if values["filename"] != "photo.jpg" {
+		t.Errorf("filename = %q, want %q", values["filename"], "photo.jpg")
+	}
+	if values["deviceId"] != "device-1" {
+		t.Errorf("deviceId = %q, want %q", values["deviceId"], "device-1")
+	}
+	if _, ok := values["isFavorite"]; !ok || values["isFavorite"] != "" {
+		t.Errorf("isFavorite = %q, want empty string present", values["isFavorite"])
+	}
+}
+
+func TestParseUploadMetadataEmpty(t *testing.T) {
+	values, err := parseUploadMetadata("")
+	if err != nil {
+		t.Fatalf("parseUploadMetadata returned error: %v", err)
+	}
+	if len(values) != 0 {
+		t.Errorf("expected empty map, got %v", values)
+	}
+}
+
+func TestParseUploadMetadataInvalidBase64(t *testing.T) {
+	if _, err := parseUploadMetadata("filename not-base64!!"); err == nil {
+		t.Error("expected an error for invalid base64 value")
+	}
+}
+
+const testTusBasePath = "/api/assets/background/tus"
+
+// newTestTusServer wires up a TusUploadHandler backed by a throwaway local
+// upload store, and a fake Immich server that finalize calls forward to,
+// returning assetID for every successful upload.
+func newTestTusServer(t *testing.T, assetID string) *httptest.Server {
+	t.Helper()
+
+	immich := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/assets" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(BackgroundUploadResponse{ID: assetID})
+	}))
+	t.Cleanup(immich.Close)
+
+	store, err := NewLocalUploadStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewLocalUploadStore returned error: %v", err)
+	}
+
+	ipResolver := proxy.NewClientIPResolver("")
+	mux := http.NewServeMux()
+	handler := TusUploadHandler(immich.URL, store, testTusBasePath, exif.StripNone, ipResolver)
+	mux.HandleFunc(testTusBasePath, handler)
+	mux.HandleFunc(testTusBasePath+"/", handler)
+
+	tus := httptest.NewServer(mux)
+	t.Cleanup(tus.Close)
+	return tus
+}
+
+func encodeMetadata(pairs map[string]string) string {
+	parts := make([]string, 0, len(pairs))
+	for k, v := range pairs {
+		parts = append(parts, k+" "+base64.StdEncoding.EncodeToString([]byte(v)))
+	}
+	return strings.Join(parts, ",")
+}
+
+func tusCreate(t *testing.T, tus *httptest.Server, length int, metadata string) (location string, resp *http.Response) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, tus.URL+testTusBasePath, nil)
+	if err != nil {
+		t.Fatalf("failed to build create request: %v", err)
+	}
+	req.Header.Set("Upload-Length", strconv.Itoa(length))
+	req.Header.Set("Upload-Metadata", metadata)
+
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("create request failed: %v", err)
+	}
+	return resp.Header.Get("Location"), resp
+}
+
+func tusPatch(t *testing.T, tus *httptest.Server, location string, offset int, body string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPatch, tus.URL+location, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("failed to build patch request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/offset+octet-stream")
+	req.Header.Set("Upload-Offset", strconv.Itoa(offset))
+	req.ContentLength = int64(len(body))
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("patch request failed: %v", err)
+	}
+	return resp
+}
+
+func TestTusCreateThenHeadReportsOffset(t *testing.T) {
+	tus := newTestTusServer(t, "asset-1")
+
+	location, resp := tusCreate(t, tus, 5, encodeMetadata(map[string]string{"deviceId": "device-1"}))
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create status = %d, want %d", resp.StatusCode, http.StatusCreated)
+	}
+	if location == "" {
+		t.Fatal("expected a Location header from create")
+	}
+
+	headReq, err := http.NewRequest(http.MethodHead, tus.URL+location, nil)
+	if err != nil {
+		t.Fatalf("failed to build head request: %v", err)
+	}
+	headResp, err := http.DefaultClient.Do(headReq)
+	if err != nil {
+		t.Fatalf("head request failed: %v", err)
+	}
+	defer headResp.Body.Close()
+
+	if headResp.StatusCode != http.StatusOK {
+		t.Fatalf("head status = %d, want %d", headResp.StatusCode, http.StatusOK)
+	}
+	if headResp.Header.Get("Upload-Offset") != "0" {
+		t.Errorf("Upload-Offset = %q, want %q", headResp.Header.Get("Upload-Offset"), "0")
+	}
+	if headResp.Header.Get("Upload-Length") != "5" {
+		t.Errorf("Upload-Length = %q, want %q", headResp.Header.Get("Upload-Length"), "5")
+	}
+}
+
+func TestTusPatchOffsetMismatchReturnsConflict(t *testing.T) {
+	tus := newTestTusServer(t, "asset-1")
+
+	location, resp := tusCreate(t, tus, 5, encodeMetadata(map[string]string{"deviceId": "device-1"}))
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create status = %d, want %d", resp.StatusCode, http.StatusCreated)
+	}
+
+	patchResp := tusPatch(t, tus, location, 2, "abc")
+	defer patchResp.Body.Close()
+	if patchResp.StatusCode != http.StatusConflict {
+		t.Errorf("patch status = %d, want %d", patchResp.StatusCode, http.StatusConflict)
+	}
+}
+
+func TestTusPatchCompletesAndFinalizeIsIdempotent(t *testing.T) {
+	tus := newTestTusServer(t, "asset-1")
+
+	location, resp := tusCreate(t, tus, 5, encodeMetadata(map[string]string{"deviceId": "device-1"}))
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create status = %d, want %d", resp.StatusCode, http.StatusCreated)
+	}
+
+	patchResp := tusPatch(t, tus, location, 0, "hello")
+	defer patchResp.Body.Close()
+	if patchResp.StatusCode != http.StatusNoContent {
+		t.Fatalf("patch status = %d, want %d", patchResp.StatusCode, http.StatusNoContent)
+	}
+	if patchResp.Header.Get("Upload-Offset") != "5" {
+		t.Errorf("Upload-Offset = %q, want %q", patchResp.Header.Get("Upload-Offset"), "5")
+	}
+
+	// A retried PATCH after the upload already finalized (e.g. iOS resuming a
+	// suspended session that actually completed) must be a idempotent no-op,
+	// not an offset-mismatch error.
+	retryResp := tusPatch(t, tus, location, 0, "hello")
+	defer retryResp.Body.Close()
+	if retryResp.StatusCode != http.StatusNoContent {
+		t.Errorf("retried patch status = %d, want %d", retryResp.StatusCode, http.StatusNoContent)
+	}
+	if retryResp.Header.Get("Upload-Offset") != "5" {
+		t.Errorf("retried patch Upload-Offset = %q, want %q", retryResp.Header.Get("Upload-Offset"), "5")
+	}
+}
+
+func TestTusCreationWithUploadFinalizesImmediately(t *testing.T) {
+	tus := newTestTusServer(t, "asset-1")
+
+	req, err := http.NewRequest(http.MethodPost, tus.URL+testTusBasePath, strings.NewReader("hello"))
+	if err != nil {
+		t.Fatalf("failed to build request: %v", err)
+	}
+	req.Header.Set("Upload-Length", "5")
+	req.Header.Set("Upload-Metadata", encodeMetadata(map[string]string{"deviceId": "device-1"}))
+	req.Header.Set("Content-Type", "application/offset+octet-stream")
+	req.ContentLength = 5
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("create-with-upload request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusCreated)
+	}
+	if resp.Header.Get("Upload-Offset") != "5" {
+		t.Errorf("Upload-Offset = %q, want %q", resp.Header.Get("Upload-Offset"), "5")
+	}
+}
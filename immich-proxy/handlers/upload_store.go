@@ -0,0 +1,263 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrUploadNotFound is returned by UploadStore methods when the upload ID is unknown.
+var ErrUploadNotFound = errors.New("upload not found")
+
+// UploadInfo describes the state of a single in-progress or completed TUS upload.
+type UploadInfo struct {
+	ID        string            `json:"id"`
+	Length    int64             `json:"length"`
+	Offset    int64             `json:"offset"`
+	Metadata  map[string]string `json:"metadata"`
+	CreatedAt time.Time         `json:"createdAt"`
+	AssetID   string            `json:"assetId,omitempty"`
+}
+
+// UploadStore persists TUS upload state so PATCH requests can resume after an
+// iOS background session is suspended and restarted.
+type UploadStore interface {
+	// Create registers a new upload and returns its initial state.
+	Create(id string, length int64, metadata map[string]string) (*UploadInfo, error)
+	// Info returns the current state of an upload, or ErrUploadNotFound.
+	Info(id string) (*UploadInfo, error)
+	// Append writes r at offset, fsyncs it, and returns the new offset.
+	// It fails if offset does not match the upload's current offset.
+	Append(id string, offset int64, r io.Reader) (int64, error)
+	// Reader opens the completed upload's bytes for finalization.
+	Reader(id string) (io.ReadCloser, error)
+	// SetAssetID records the Immich asset ID produced by finalization, making
+	// repeated finalize calls for the same upload idempotent.
+	SetAssetID(id string, assetID string) error
+	// Delete removes all state for an upload.
+	Delete(id string) error
+	// Stale returns the IDs of uploads created before olderThan.
+	Stale(olderThan time.Time) ([]string, error)
+}
+
+// localUploadStore stores each upload as a pair of files in dir:
+// "<id>.part" holds the raw bytes appended so far, "<id>.json" the sidecar
+// UploadInfo. Both are fsynced after every PATCH so a crash loses at most the
+// in-flight chunk.
+type localUploadStore struct {
+	dir   string
+	locks sync.Map // id -> *sync.Mutex
+}
+
+// NewLocalUploadStore creates an UploadStore rooted at dir, creating it if needed.
+func NewLocalUploadStore(dir string) (UploadStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create upload store dir: %w", err)
+	}
+	return &localUploadStore{dir: dir}, nil
+}
+
+func (s *localUploadStore) partPath(id string) string { return filepath.Join(s.dir, id+".part") }
+func (s *localUploadStore) metaPath(id string) string { return filepath.Join(s.dir, id+".json") }
+
+// lockFor returns the mutex serializing access to id's files, creating one on
+// first use. Locking per upload ID rather than store-wide means one slow
+// in-flight PATCH (streaming a multi-gigabyte chunk to disk) only blocks
+// further requests for that same upload, not every other concurrent upload.
+func (s *localUploadStore) lockFor(id string) *sync.Mutex {
+	v, _ := s.locks.LoadOrStore(id, &sync.Mutex{})
+	return v.(*sync.Mutex)
+}
+
+func (s *localUploadStore) Create(id string, length int64, metadata map[string]string) (*UploadInfo, error) {
+	lock := s.lockFor(id)
+	lock.Lock()
+	defer lock.Unlock()
+
+	part, err := os.OpenFile(s.partPath(id), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create part file: %w", err)
+	}
+	part.Close()
+
+	info := &UploadInfo{
+		ID:        id,
+		Length:    length,
+		Offset:    0,
+		Metadata:  metadata,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := s.writeInfo(info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+func (s *localUploadStore) Info(id string) (*UploadInfo, error) {
+	lock := s.lockFor(id)
+	lock.Lock()
+	defer lock.Unlock()
+	return s.readInfo(id)
+}
+
+func (s *localUploadStore) Append(id string, offset int64, r io.Reader) (int64, error) {
+	lock := s.lockFor(id)
+	lock.Lock()
+	defer lock.Unlock()
+
+	info, err := s.readInfo(id)
+	if err != nil {
+		return 0, err
+	}
+	if offset != info.Offset {
+		return 0, fmt.Errorf("offset mismatch: have %d, got %d", info.Offset, offset)
+	}
+
+	part, err := os.OpenFile(s.partPath(id), os.O_WRONLY, 0o644)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open part file: %w", err)
+	}
+	defer part.Close()
+
+	if _, err := part.Seek(offset, io.SeekStart); err != nil {
+		return 0, fmt.Errorf("failed to seek part file: %w", err)
+	}
+
+	n, err := io.Copy(part, r)
+	if err != nil {
+		return 0, fmt.Errorf("failed to append upload data: %w", err)
+	}
+	if err := part.Sync(); err != nil {
+		return 0, fmt.Errorf("failed to fsync part file: %w", err)
+	}
+
+	info.Offset += n
+	if err := s.writeInfo(info); err != nil {
+		return 0, err
+	}
+	return info.Offset, nil
+}
+
+func (s *localUploadStore) Reader(id string) (io.ReadCloser, error) {
+	lock := s.lockFor(id)
+	lock.Lock()
+	defer lock.Unlock()
+
+	f, err := os.Open(s.partPath(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrUploadNotFound
+		}
+		return nil, fmt.Errorf("failed to open part file: %w", err)
+	}
+	return f, nil
+}
+
+func (s *localUploadStore) SetAssetID(id string, assetID string) error {
+	lock := s.lockFor(id)
+	lock.Lock()
+	defer lock.Unlock()
+
+	info, err := s.readInfo(id)
+	if err != nil {
+		return err
+	}
+	info.AssetID = assetID
+	return s.writeInfo(info)
+}
+
+func (s *localUploadStore) Delete(id string) error {
+	lock := s.lockFor(id)
+	lock.Lock()
+	partErr := os.Remove(s.partPath(id))
+	metaErr := os.Remove(s.metaPath(id))
+	lock.Unlock()
+
+	// The ID is gone for good once its files are removed, so drop its lock
+	// too rather than leaking one sync.Mutex per upload for the life of the
+	// process.
+	s.locks.Delete(id)
+
+	if partErr != nil && !os.IsNotExist(partErr) {
+		return fmt.Errorf("failed to delete part file: %w", partErr)
+	}
+	if metaErr != nil && !os.IsNotExist(metaErr) {
+		return fmt.Errorf("failed to delete meta file: %w", metaErr)
+	}
+	return nil
+}
+
+// Stale lists IDs without holding any per-upload lock: writeInfo persists
+// via write-tmp-then-rename, so a concurrent Append can never leave readInfo
+// looking at a partially written .json file, only an older or newer complete
+// one.
+func (s *localUploadStore) Stale(olderThan time.Time) ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list upload store dir: %w", err)
+	}
+
+	var stale []string
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		id := strings.TrimSuffix(entry.Name(), ".json")
+		info, err := s.readInfo(id)
+		if err != nil {
+			continue
+		}
+		if info.CreatedAt.Before(olderThan) {
+			stale = append(stale, id)
+		}
+	}
+	return stale, nil
+}
+
+func (s *localUploadStore) readInfo(id string) (*UploadInfo, error) {
+	data, err := os.ReadFile(s.metaPath(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrUploadNotFound
+		}
+		return nil, fmt.Errorf("failed to read upload metadata: %w", err)
+	}
+	var info UploadInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, fmt.Errorf("failed to parse upload metadata: %w", err)
+	}
+	return &info, nil
+}
+
+func (s *localUploadStore) writeInfo(info *UploadInfo) error {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return fmt.Errorf("failed to marshal upload metadata: %w", err)
+	}
+	tmp := s.metaPath(info.ID) + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to write upload metadata: %w", err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write upload metadata: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to fsync upload metadata: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write upload metadata: %w", err)
+	}
+	if err := os.Rename(tmp, s.metaPath(info.ID)); err != nil {
+		return fmt.Errorf("failed to persist upload metadata: %w", err)
+	}
+	return nil
+}
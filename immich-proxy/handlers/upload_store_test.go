@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestAppendDoesNotBlockOtherUploads guards against a regression to a single
+// store-wide lock: a slow Append for one upload ID must not hold up Create
+// or Append for a different, unrelated ID.
+func TestAppendDoesNotBlockOtherUploads(t *testing.T) {
+	store, err := NewLocalUploadStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewLocalUploadStore returned error: %v", err)
+	}
+
+	if _, err := store.Create("slow", 10, nil); err != nil {
+		t.Fatalf("Create(slow) returned error: %v", err)
+	}
+
+	started := make(chan struct{})
+	unblock := make(chan struct{})
+	slowDone := make(chan struct{})
+	go func() {
+		defer close(slowDone)
+		r := &blockingReader{r: strings.NewReader("0123456789"), started: started, unblock: unblock}
+		if _, err := store.Append("slow", 0, r); err != nil {
+			t.Errorf("Append(slow) returned error: %v", err)
+		}
+	}()
+	<-started
+
+	fastDone := make(chan struct{})
+	go func() {
+		defer close(fastDone)
+		if _, err := store.Create("fast", 5, nil); err != nil {
+			t.Errorf("Create(fast) returned error: %v", err)
+		}
+		if _, err := store.Append("fast", 0, strings.NewReader("hello")); err != nil {
+			t.Errorf("Append(fast) returned error: %v", err)
+		}
+	}()
+
+	select {
+	case <-fastDone:
+	case <-time.After(time.Second):
+		t.Fatal("Create/Append for an unrelated upload ID was blocked by a slow Append in progress")
+	}
+
+	close(unblock)
+	<-slowDone
+}
+
+// blockingReader signals started on its first Read, then waits for unblock
+// before returning any data, simulating a slow in-flight PATCH.
+type blockingReader struct {
+	r        io.Reader
+	started  chan struct{}
+	unblock  chan struct{}
+	signaled bool
+}
+
+func (r *blockingReader) Read(p []byte) (int, error) {
+	if !r.signaled {
+		r.signaled = true
+		close(r.started)
+		<-r.unblock
+	}
+	return r.r.Read(p)
+}
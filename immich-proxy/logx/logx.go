@@ -0,0 +1,119 @@
+// Package logx wraps log/slog to produce structured JSON logs for this
+// server, replacing the plain log.Printf calls main, proxy, and handlers used
+// to emit. Request-scoped logs carry a request ID generated in main's
+// logMiddleware so a proxy log line and the matching Immich-side log line can
+// be correlated.
+package logx
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"os"
+)
+
+var base = slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
+	ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+		if a.Key == slog.TimeKey {
+			a.Key = "ts"
+		}
+		return a
+	},
+}))
+
+type contextKey string
+
+const (
+	requestIDContextKey      contextKey = "logx.requestID"
+	upstreamStatusContextKey contextKey = "logx.upstreamStatus"
+)
+
+// NewRequestID returns a random hex-encoded request ID.
+func NewRequestID() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		// crypto/rand failing is effectively unrecoverable, but a log line
+		// losing its correlation ID shouldn't take the request down with it.
+		return "unknown"
+	}
+	return hex.EncodeToString(buf)
+}
+
+// WithRequestID returns a copy of ctx carrying id, for handlers and outbound
+// requests downstream of logMiddleware to pick up.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey, id)
+}
+
+// RequestIDFromContext returns the request ID stored in ctx by
+// WithRequestID, if any.
+func RequestIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(requestIDContextKey).(string)
+	return id, ok
+}
+
+// WithUpstreamStatus returns a copy of ctx carrying a pointer that code
+// downstream of logMiddleware (forwardAssetUpload, the reverse proxy's
+// ModifyResponse) can set via SetUpstreamStatus once Immich actually
+// responds. The pointer is returned so the caller can read it back after the
+// request completes; it stays at its zero value if no upstream call is ever
+// made, e.g. a request the auth middleware rejects before reaching Immich.
+func WithUpstreamStatus(ctx context.Context) (context.Context, *int) {
+	status := new(int)
+	return context.WithValue(ctx, upstreamStatusContextKey, status), status
+}
+
+// SetUpstreamStatus records the real status Immich returned for the request
+// carried by ctx, if ctx came from WithUpstreamStatus. It's a no-op otherwise
+// (e.g. in tests that don't wire up the context value).
+func SetUpstreamStatus(ctx context.Context, status int) {
+	if p, ok := ctx.Value(upstreamStatusContextKey).(*int); ok {
+		*p = status
+	}
+}
+
+// RequestFields is one completed request's worth of structured log fields.
+type RequestFields struct {
+	RequestID      string
+	ClientIP       string
+	Method         string
+	Path           string
+	Status         int
+	BytesIn        int64
+	BytesOut       int64
+	DurationMS     int64
+	UpstreamStatus int
+}
+
+// Request logs a completed request as a single structured JSON line.
+func Request(f RequestFields) {
+	base.Info("request",
+		"request_id", f.RequestID,
+		"client_ip", f.ClientIP,
+		"method", f.Method,
+		"path", f.Path,
+		"status", f.Status,
+		"bytes_in", f.BytesIn,
+		"bytes_out", f.BytesOut,
+		"duration_ms", f.DurationMS,
+		"upstream_status", f.UpstreamStatus,
+	)
+}
+
+// Info logs msg at info level with the given key/value attribute pairs,
+// standing in for the server's old log.Printf(fmt.Sprintf(...)) calls.
+func Info(msg string, args ...any) { base.Info(msg, args...) }
+
+// Warn logs msg at warn level.
+func Warn(msg string, args ...any) { base.Warn(msg, args...) }
+
+// Error logs msg at error level.
+func Error(msg string, args ...any) { base.Error(msg, args...) }
+
+// Fatal logs msg at error level and then exits the process, mirroring
+// log.Fatalf for the handful of startup failures that should abort main.
+func Fatal(msg string, args ...any) {
+	base.Error(msg, args...)
+	os.Exit(1)
+}
@@ -0,0 +1,56 @@
+package logx
+
+import (
+	"context"
+	"testing"
+)
+
+func TestNewRequestIDIsUnique(t *testing.T) {
+	a := NewRequestID()
+	b := NewRequestID()
+	if a == b {
+		t.Errorf("NewRequestID() returned the same ID twice: %q", a)
+	}
+	if len(a) == 0 {
+		t.Error("NewRequestID() returned an empty string")
+	}
+}
+
+func TestRequestIDContextRoundTrip(t *testing.T) {
+	ctx := WithRequestID(context.Background(), "abc123")
+
+	id, ok := RequestIDFromContext(ctx)
+	if !ok {
+		t.Fatal("RequestIDFromContext() ok = false, want true")
+	}
+	if id != "abc123" {
+		t.Errorf("RequestIDFromContext() = %q, want %q", id, "abc123")
+	}
+}
+
+func TestRequestIDFromContextMissing(t *testing.T) {
+	if _, ok := RequestIDFromContext(context.Background()); ok {
+		t.Error("RequestIDFromContext() ok = true for a context with no request ID")
+	}
+}
+
+func TestUpstreamStatusRoundTrip(t *testing.T) {
+	ctx, status := WithUpstreamStatus(context.Background())
+	SetUpstreamStatus(ctx, 201)
+
+	if *status != 201 {
+		t.Errorf("*status = %d, want %d", *status, 201)
+	}
+}
+
+func TestUpstreamStatusStaysZeroWhenNeverSet(t *testing.T) {
+	_, status := WithUpstreamStatus(context.Background())
+
+	if *status != 0 {
+		t.Errorf("*status = %d, want 0 (no upstream call made)", *status)
+	}
+}
+
+func TestSetUpstreamStatusOnContextWithoutCarrierIsNoop(t *testing.T) {
+	SetUpstreamStatus(context.Background(), 500) // must not panic
+}
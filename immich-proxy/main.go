@@ -1,25 +1,60 @@
 package main
 
 import (
-	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
+	"immich-proxy/auth"
+	"immich-proxy/exif"
 	"immich-proxy/handlers"
+	"immich-proxy/logx"
+	"immich-proxy/metrics"
 	"immich-proxy/proxy"
 )
 
+// tusBasePath is where TusUploadHandler is mounted, shared with the handler
+// so it can compute Location headers and strip upload IDs from the path.
+const tusBasePath = "/api/assets/background/tus"
+
 func main() {
 	// Load configuration from environment variables
 	config := loadConfig()
 
-	log.Printf("Starting Immich Proxy Server...")
-	log.Printf("Listening on: %s", config.ListenAddr)
-	log.Printf("Immich Server: %s", config.ImmichServerURL)
+	logx.Info("starting immich proxy server", "listen_addr", config.ListenAddr, "immich_server", config.ImmichServerURL)
+
+	go func() {
+		logx.Info("starting metrics server", "metrics_addr", config.MetricsAddr)
+		if err := metrics.Serve(config.MetricsAddr); err != nil {
+			logx.Fatal("metrics server failed", "err", err)
+		}
+	}()
+
+	ipResolver := proxy.NewClientIPResolver(config.TrustedProxies)
 
 	// Create reverse proxy for general API calls
-	reverseProxy := proxy.NewReverseProxy(config.ImmichServerURL)
+	reverseProxy := proxy.NewReverseProxy(config.ImmichServerURL, ipResolver)
+
+	uploadStore, err := handlers.NewLocalUploadStore(config.TusUploadDir)
+	if err != nil {
+		logx.Fatal("failed to create upload store", "err", err)
+	}
+	handlers.StartUploadJanitor(uploadStore, config.TusUploadTTL, config.TusJanitorInterval)
+
+	// Proxy-level API key auth is optional: if API_KEYS_FILE isn't set, every
+	// request is forwarded as-is, matching this server's historical behavior.
+	var authenticator *auth.Authenticator
+	if config.APIKeysFile != "" {
+		authenticator, err = auth.NewAuthenticator(config.APIKeysFile)
+		if err != nil {
+			logx.Fatal("failed to load API keys", "err", err)
+		}
+		logx.Info("proxy API key auth enabled", "api_keys_file", config.APIKeysFile)
+	} else {
+		logx.Info("API_KEYS_FILE not set; proxy API key auth is disabled")
+	}
 
 	// Create multiplexer
 	mux := http.NewServeMux()
@@ -28,24 +63,36 @@ func main() {
 	mux.HandleFunc("/health", handlers.HealthHandler)
 
 	// Background upload endpoint - converts raw photo data to multipart form-data
-	mux.HandleFunc("/api/assets/background", handlers.BackgroundUploadHandler(config.ImmichServerURL))
+	mux.HandleFunc("/api/assets/background", withAuth(authenticator, handlers.BackgroundUploadHandler(config.ImmichServerURL, config.EXIFStripMode, ipResolver)))
+
+	// TUS resumable background upload endpoint, for sessions that may be
+	// suspended and restarted mid-upload by iOS.
+	mux.HandleFunc(tusBasePath, withAuth(authenticator, handlers.TusUploadHandler(config.ImmichServerURL, uploadStore, tusBasePath, config.EXIFStripMode, ipResolver)))
+	mux.HandleFunc(tusBasePath+"/", withAuth(authenticator, handlers.TusUploadHandler(config.ImmichServerURL, uploadStore, tusBasePath, config.EXIFStripMode, ipResolver)))
 
 	// All other requests are proxied directly to Immich server
-	mux.HandleFunc("/", reverseProxy.Handler())
+	mux.HandleFunc("/", withAuth(authenticator, reverseProxy.Handler()))
 
 	// Start server
 	server := &http.Server{
 		Addr:    config.ListenAddr,
-		Handler: logMiddleware(mux),
+		Handler: logMiddleware(mux, ipResolver),
 	}
 
-	log.Fatal(server.ListenAndServe())
+	logx.Fatal("server stopped", "err", server.ListenAndServe())
 }
 
 // Config holds the server configuration
 type Config struct {
-	ListenAddr      string
-	ImmichServerURL string
+	ListenAddr         string
+	ImmichServerURL    string
+	TusUploadDir       string
+	TusUploadTTL       time.Duration
+	TusJanitorInterval time.Duration
+	EXIFStripMode      exif.StripMode
+	TrustedProxies     string
+	APIKeysFile        string
+	MetricsAddr        string
 }
 
 // loadConfig loads configuration from environment variables
@@ -60,51 +107,123 @@ func loadConfig() *Config {
 		immichServerURL = "http://localhost:2283"
 	}
 
+	tusUploadDir := os.Getenv("TUS_UPLOAD_DIR")
+	if tusUploadDir == "" {
+		tusUploadDir = "/tmp/immich-proxy-uploads"
+	}
+
+	tusUploadTTL := 24 * time.Hour
+	if v := os.Getenv("TUS_UPLOAD_TTL_HOURS"); v != "" {
+		if hours, err := strconv.Atoi(v); err == nil {
+			tusUploadTTL = time.Duration(hours) * time.Hour
+		}
+	}
+
+	metricsAddr := os.Getenv("METRICS_ADDR")
+	if metricsAddr == "" {
+		metricsAddr = ":9090"
+	}
+
 	return &Config{
-		ListenAddr:      listenAddr,
-		ImmichServerURL: immichServerURL,
+		ListenAddr:         listenAddr,
+		ImmichServerURL:    immichServerURL,
+		TusUploadDir:       tusUploadDir,
+		TusUploadTTL:       tusUploadTTL,
+		TusJanitorInterval: 15 * time.Minute,
+		EXIFStripMode:      exif.ParseStripMode(os.Getenv("EXIF_STRIP_MODE")),
+		TrustedProxies:     os.Getenv("TRUSTED_PROXIES"),
+		APIKeysFile:        os.Getenv("API_KEYS_FILE"),
+		MetricsAddr:        metricsAddr,
+	}
+}
+
+// withAuth wraps next with authenticator's middleware, or returns next
+// unchanged if authenticator is nil (API_KEYS_FILE not configured).
+func withAuth(authenticator *auth.Authenticator, next http.HandlerFunc) http.HandlerFunc {
+	if authenticator == nil {
+		return next
 	}
+	return authenticator.Middleware(next).ServeHTTP
 }
 
-// logMiddleware logs all incoming requests except health checks
-func logMiddleware(next http.Handler) http.Handler {
+// logMiddleware logs all incoming requests except health checks, records
+// proxy_requests_total/proxy_request_duration_seconds, and generates a
+// request ID that's threaded into the reverse proxy director and the Immich
+// outbound request so logs on both sides of the proxy can be correlated.
+func logMiddleware(next http.Handler, ipResolver *proxy.ClientIPResolver) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Skip logging for health check endpoint to reduce log noise
-		if r.URL.Path != "/health" {
-			clientIP := GetClientIP(r)
-			log.Printf("[%s] %s %s", r.Method, r.URL.Path, clientIP)
+		if r.URL.Path == "/health" {
+			next.ServeHTTP(w, r)
+			return
 		}
-		next.ServeHTTP(w, r)
+
+		requestID := logx.NewRequestID()
+		r.Header.Set("X-Request-Id", requestID)
+		ctx, upstreamStatus := logx.WithUpstreamStatus(r.Context())
+		r = r.WithContext(logx.WithRequestID(ctx, requestID))
+		w.Header().Set("X-Request-Id", requestID)
+
+		clientIP := ipResolver.Resolve(r)
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(rec, r)
+
+		duration := time.Since(start)
+		route := routeLabel(r.URL.Path)
+		metrics.RequestsTotal.WithLabelValues(route, r.Method, strconv.Itoa(rec.status)).Inc()
+		metrics.RequestDuration.Observe(duration.Seconds())
+
+		logx.Request(logx.RequestFields{
+			RequestID:      requestID,
+			ClientIP:       clientIP,
+			Method:         r.Method,
+			Path:           r.URL.Path,
+			Status:         rec.status,
+			BytesIn:        r.ContentLength,
+			BytesOut:       rec.bytes,
+			DurationMS:     duration.Milliseconds(),
+			UpstreamStatus: *upstreamStatus,
+		})
 	})
 }
 
-// GetClientIP extracts the real client IP from the request.
-// It checks X-Forwarded-For and X-Real-IP headers first (for proxy scenarios),
-// then falls back to RemoteAddr.
-func GetClientIP(r *http.Request) string {
-	// Check X-Forwarded-For header first (may contain multiple IPs)
-	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-		// X-Forwarded-For can contain multiple IPs: client, proxy1, proxy2...
-		// The first IP is typically the original client
-		ips := strings.Split(xff, ",")
-		if len(ips) > 0 {
-			clientIP := strings.TrimSpace(ips[0])
-			if clientIP != "" {
-				return clientIP
-			}
-		}
+// routeLabel buckets a request path into a small, fixed set of route names
+// so the proxy_requests_total route label doesn't grow unbounded.
+func routeLabel(path string) string {
+	switch {
+	case strings.HasPrefix(path, tusBasePath):
+		return "background_tus"
+	case path == "/api/assets/background":
+		return "background"
+	default:
+		return "proxy"
 	}
+}
 
-	// Check X-Real-IP header (set by NGINX)
-	if xri := r.Header.Get("X-Real-IP"); xri != "" {
-		return xri
-	}
+// statusRecorder wraps http.ResponseWriter to capture the status code and
+// byte count written, for logging and metrics. It implements http.Flusher so
+// streamed reverse-proxy responses still flush promptly.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
 
-	// Check CF-Connecting-IP header (Cloudflare)
-	if cfIP := r.Header.Get("CF-Connecting-IP"); cfIP != "" {
-		return cfIP
-	}
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
 
-	// Fall back to RemoteAddr
-	return r.RemoteAddr
+func (r *statusRecorder) Write(p []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(p)
+	r.bytes += int64(n)
+	return n, err
+}
+
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
 }
@@ -0,0 +1,67 @@
+// Package metrics exposes this server's Prometheus counters and histograms.
+// They're served on their own listener (METRICS_ADDR) rather than being
+// registered on the main mux, so a scrape request never gets forwarded to
+// the Immich backend by the catch-all reverse proxy route.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	// RequestsTotal counts every request the proxy handled, by route, method,
+	// and response status.
+	RequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "proxy_requests_total",
+		Help: "Total number of HTTP requests handled by the proxy.",
+	}, []string{"route", "method", "status"})
+
+	// RequestDuration tracks end-to-end latency for requests the proxy handled.
+	RequestDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "proxy_request_duration_seconds",
+		Help:    "Latency of requests handled by the proxy, in seconds.",
+		Buckets: prometheus.DefBuckets,
+	})
+
+	// BackgroundUploadBytes tracks the size of asset data forwarded to Immich
+	// through the background upload and TUS endpoints.
+	BackgroundUploadBytes = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "background_upload_bytes",
+		Help:    "Size in bytes of background asset uploads forwarded to Immich.",
+		Buckets: prometheus.ExponentialBuckets(1<<16, 4, 10), // 64KiB .. 16GiB
+	})
+
+	// BackgroundUploadDuration tracks how long it takes to forward a
+	// background upload to Immich, split by outcome.
+	BackgroundUploadDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "background_upload_duration_seconds",
+		Help:    "Time to forward a background asset upload to Immich, in seconds.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"outcome"})
+
+	// UpstreamErrorsTotal counts requests that failed to reach Immich at all
+	// (as opposed to Immich responding with an error status).
+	UpstreamErrorsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "upstream_errors_total",
+		Help: "Total requests that failed to reach the Immich server.",
+	})
+
+	// InflightUploads reports how many background asset uploads are
+	// currently being streamed to Immich.
+	InflightUploads = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "inflight_uploads",
+		Help: "Number of background asset uploads currently being forwarded to Immich.",
+	})
+)
+
+// Serve starts a dedicated HTTP server exposing /metrics on addr. It blocks
+// until the server stops, so callers run it in a goroutine.
+func Serve(addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	return http.ListenAndServe(addr, mux)
+}
@@ -0,0 +1,133 @@
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"immich-proxy/logx"
+)
+
+// ClientIPResolver extracts the real client IP from a request, trusting
+// forwarding headers (X-Forwarded-For, X-Real-IP, CF-Connecting-IP) only
+// when they were set by a proxy hop the operator has explicitly configured.
+// Without it, any direct caller could spoof its IP in logs or future
+// rate-limit/auth decisions just by sending those headers itself.
+type ClientIPResolver struct {
+	trusted []*net.IPNet
+}
+
+// NewClientIPResolver builds a resolver from a comma-separated TRUSTED_PROXIES
+// value, where each entry is a CIDR (e.g. "10.0.0.0/8") or the special token
+// "cloudflare", which expands to Cloudflare's bundled edge IP ranges.
+// Unparseable entries are logged and skipped rather than treated as fatal.
+func NewClientIPResolver(trustedProxies string) *ClientIPResolver {
+	r := &ClientIPResolver{}
+
+	for _, entry := range strings.Split(trustedProxies, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if strings.EqualFold(entry, "cloudflare") {
+			for _, cidr := range cloudflareRanges {
+				if _, ipNet, err := net.ParseCIDR(cidr); err == nil {
+					r.trusted = append(r.trusted, ipNet)
+				}
+			}
+			continue
+		}
+
+		if !strings.Contains(entry, "/") {
+			entry += singleHostSuffix(entry)
+		}
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			logx.Warn("skipping invalid TRUSTED_PROXIES entry", "entry", entry, "err", err)
+			continue
+		}
+		r.trusted = append(r.trusted, ipNet)
+	}
+
+	return r
+}
+
+// singleHostSuffix returns the CIDR suffix that turns a bare IP into a
+// single-host network, so TRUSTED_PROXIES can list individual proxy IPs
+// without requiring operators to spell out /32 or /128.
+func singleHostSuffix(ip string) string {
+	if strings.Contains(ip, ":") {
+		return "/128"
+	}
+	return "/32"
+}
+
+// Resolve returns the client IP for r. If r.RemoteAddr is in the trusted set,
+// it walks X-Forwarded-For right-to-left skipping trusted hops and returns
+// the first untrusted IP, or honors X-Real-IP/CF-Connecting-IP. Otherwise it
+// ignores all forwarding headers and returns RemoteAddr directly.
+func (r *ClientIPResolver) Resolve(req *http.Request) string {
+	remoteIP := hostFromAddr(req.RemoteAddr)
+
+	if !r.isTrusted(remoteIP) {
+		return fallback(remoteIP, req.RemoteAddr)
+	}
+
+	if xff := req.Header.Get("X-Forwarded-For"); xff != "" {
+		hops := strings.Split(xff, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if hop == "" {
+				continue
+			}
+			if ip := net.ParseIP(hop); ip != nil && !r.isTrusted(ip) {
+				return hop
+			}
+		}
+		// Every hop was trusted; fall back to the left-most (original client).
+		if first := strings.TrimSpace(hops[0]); first != "" {
+			return first
+		}
+	}
+
+	if xri := req.Header.Get("X-Real-IP"); xri != "" {
+		return xri
+	}
+	if cfIP := req.Header.Get("CF-Connecting-IP"); cfIP != "" {
+		return cfIP
+	}
+
+	return fallback(remoteIP, req.RemoteAddr)
+}
+
+func (r *ClientIPResolver) isTrusted(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range r.trusted {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// hostFromAddr extracts the IP from a "host:port" RemoteAddr, returning nil
+// if it can't be parsed (e.g. in tests that set a bare IP).
+func hostFromAddr(addr string) net.IP {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	return net.ParseIP(host)
+}
+
+// fallback returns RemoteAddr verbatim, preferring the host-only form when it
+// parsed cleanly so logs aren't cluttered with a meaningless port.
+func fallback(remoteIP net.IP, remoteAddr string) string {
+	if remoteIP != nil {
+		return remoteIP.String()
+	}
+	return remoteAddr
+}
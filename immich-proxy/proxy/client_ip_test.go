@@ -0,0 +1,81 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newTestRequest(remoteAddr string, headers map[string]string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = remoteAddr
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	return req
+}
+
+func TestClientIPResolverUntrustedRemoteIgnoresHeaders(t *testing.T) {
+	r := NewClientIPResolver("10.0.0.0/8")
+	req := newTestRequest("203.0.113.5:1234", map[string]string{
+		"X-Forwarded-For": "198.51.100.9",
+		"X-Real-IP":       "198.51.100.9",
+	})
+
+	if got := r.Resolve(req); got != "203.0.113.5" {
+		t.Errorf("Resolve() = %q, want %q (headers from an untrusted peer must be ignored)", got, "203.0.113.5")
+	}
+}
+
+func TestClientIPResolverTrustedRemoteHonorsXFF(t *testing.T) {
+	r := NewClientIPResolver("10.0.0.0/8")
+	req := newTestRequest("10.0.0.1:1234", map[string]string{
+		"X-Forwarded-For": "198.51.100.9, 10.0.0.2, 10.0.0.1",
+	})
+
+	if got := r.Resolve(req); got != "198.51.100.9" {
+		t.Errorf("Resolve() = %q, want %q", got, "198.51.100.9")
+	}
+}
+
+func TestClientIPResolverTrustedRemoteAllHopsTrusted(t *testing.T) {
+	r := NewClientIPResolver("10.0.0.0/8")
+	req := newTestRequest("10.0.0.1:1234", map[string]string{
+		"X-Forwarded-For": "10.0.0.3, 10.0.0.2, 10.0.0.1",
+	})
+
+	if got := r.Resolve(req); got != "10.0.0.3" {
+		t.Errorf("Resolve() = %q, want left-most hop %q", got, "10.0.0.3")
+	}
+}
+
+func TestClientIPResolverTrustedRemoteHonorsXRealIP(t *testing.T) {
+	r := NewClientIPResolver("10.0.0.0/8")
+	req := newTestRequest("10.0.0.1:1234", map[string]string{
+		"X-Real-IP": "198.51.100.9",
+	})
+
+	if got := r.Resolve(req); got != "198.51.100.9" {
+		t.Errorf("Resolve() = %q, want %q", got, "198.51.100.9")
+	}
+}
+
+func TestClientIPResolverFallsBackToRemoteAddr(t *testing.T) {
+	r := NewClientIPResolver("")
+	req := newTestRequest("203.0.113.5:1234", nil)
+
+	if got := r.Resolve(req); got != "203.0.113.5" {
+		t.Errorf("Resolve() = %q, want %q", got, "203.0.113.5")
+	}
+}
+
+func TestClientIPResolverCloudflareToken(t *testing.T) {
+	r := NewClientIPResolver("cloudflare")
+	req := newTestRequest("173.245.48.1:1234", map[string]string{
+		"CF-Connecting-IP": "198.51.100.9",
+	})
+
+	if got := r.Resolve(req); got != "198.51.100.9" {
+		t.Errorf("Resolve() = %q, want %q", got, "198.51.100.9")
+	}
+}
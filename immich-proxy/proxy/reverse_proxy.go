@@ -1,62 +1,34 @@
 package proxy
 
 import (
-	"log"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
-	"strings"
-)
-
-// GetClientIP extracts the real client IP from the request.
-// It checks X-Forwarded-For and X-Real-IP headers first (for proxy scenarios),
-// then falls back to RemoteAddr.
-func GetClientIP(r *http.Request) string {
-	// Check X-Forwarded-For header first (may contain multiple IPs)
-	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-		// X-Forwarded-For can contain multiple IPs: client, proxy1, proxy2...
-		// The first IP is typically the original client
-		ips := strings.Split(xff, ",")
-		if len(ips) > 0 {
-			clientIP := strings.TrimSpace(ips[0])
-			if clientIP != "" {
-				return clientIP
-			}
-		}
-	}
 
-	// Check X-Real-IP header (set by NGINX)
-	if xri := r.Header.Get("X-Real-IP"); xri != "" {
-		return xri
-	}
-
-	// Check CF-Connecting-IP header (Cloudflare)
-	if cfIP := r.Header.Get("CF-Connecting-IP"); cfIP != "" {
-		return cfIP
-	}
-
-	// Fall back to RemoteAddr
-	return r.RemoteAddr
-}
+	"immich-proxy/logx"
+	"immich-proxy/metrics"
+)
 
 // ReverseProxy handles proxying requests to the Immich server
 type ReverseProxy struct {
-	targetURL *url.URL
-	proxy     *httputil.ReverseProxy
+	targetURL  *url.URL
+	proxy      *httputil.ReverseProxy
+	ipResolver *ClientIPResolver
 }
 
 // NewReverseProxy creates a new reverse proxy for the given target URL
-func NewReverseProxy(targetURL string) *ReverseProxy {
+func NewReverseProxy(targetURL string, ipResolver *ClientIPResolver) *ReverseProxy {
 	target, err := url.Parse(targetURL)
 	if err != nil {
-		log.Fatalf("Failed to parse target URL: %v", err)
+		logx.Fatal("failed to parse target URL", "target_url", targetURL, "err", err)
 	}
 
 	proxy := httputil.NewSingleHostReverseProxy(target)
 
 	// Customize error handler
 	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
-		log.Printf("Proxy error: %v", err)
+		metrics.UpstreamErrorsTotal.Inc()
+		logx.Error("proxy error", "err", err)
 		http.Error(w, "Proxy error: "+err.Error(), http.StatusBadGateway)
 	}
 
@@ -66,19 +38,30 @@ func NewReverseProxy(targetURL string) *ReverseProxy {
 		originalDirector(r)
 		// Preserve the original Host header or set it to the target
 		r.Host = target.Host
+		if requestID, ok := logx.RequestIDFromContext(r.Context()); ok {
+			r.Header.Set("X-Request-Id", requestID)
+		}
+	}
+
+	// Record the real status Immich returned so logMiddleware can log it
+	// alongside the client-facing status, instead of aliasing the two.
+	proxy.ModifyResponse = func(resp *http.Response) error {
+		logx.SetUpstreamStatus(resp.Request.Context(), resp.StatusCode)
+		return nil
 	}
 
 	return &ReverseProxy{
-		targetURL: target,
-		proxy:     proxy,
+		targetURL:  target,
+		proxy:      proxy,
+		ipResolver: ipResolver,
 	}
 }
 
 // Handler returns the HTTP handler function for the reverse proxy
 func (rp *ReverseProxy) Handler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		clientIP := GetClientIP(r)
-		log.Printf("[%s] Proxying request: %s %s -> %s%s", clientIP, r.Method, r.URL.Path, rp.targetURL.String(), r.URL.Path)
+		clientIP := rp.ipResolver.Resolve(r)
+		logx.Info("proxying request", "client_ip", clientIP, "method", r.Method, "path", r.URL.Path, "target", rp.targetURL.String())
 		rp.proxy.ServeHTTP(w, r)
 	}
 }